@@ -1,6 +1,6 @@
 module github.com/Antimatterr/psygateway
 
-go 1.23.8
+go 1.24.0
 
 toolchain go1.24.5
 
@@ -8,6 +8,10 @@ require github.com/joho/godotenv v1.5.1
 
 require github.com/lib/pq v1.10.9
 
+require google.golang.org/protobuf v1.36.6
+
+require golang.org/x/crypto v0.41.0
+
 require (
 	github.com/armon/go-metrics v0.4.1 // indirect
 	github.com/fatih/color v1.16.0 // indirect
@@ -25,5 +29,7 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	golang.org/x/exp v0.0.0-20250305212735-054e65f0b394 // indirect
-	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/net v0.42.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 )
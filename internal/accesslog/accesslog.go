@@ -0,0 +1,269 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// Entry describes one request handled by the gateway. The handler creates it,
+// the proxy path fills in routing and upstream details, and it is written
+// once the response is complete.
+type Entry struct {
+	Time      time.Time
+	RequestID string
+	ClientIP  string
+	User      string
+	Method    string
+	Path      string
+	Query     string
+	Proto     string
+	Referer   string
+	UserAgent string
+
+	RouteID  int
+	Service  string
+	Upstream string
+	Attempts int
+
+	Status   int
+	BytesIn  int64
+	BytesOut int64
+
+	// ResolveDuration is the time spent picking upstream instances and
+	// UpstreamDuration the time waiting for upstream response headers, both
+	// summed over attempts. TotalDuration covers the whole request.
+	ResolveDuration  time.Duration
+	UpstreamDuration time.Duration
+	TotalDuration    time.Duration
+}
+
+// Format selects how entries are rendered.
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatCommon
+	FormatCombined
+	FormatTemplate
+)
+
+// Logger writes one line per entry to its own writer, independent from the
+// application logger.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	tmpl   *template.Template
+}
+
+// New creates an access logger. format is "json", "common", "combined" or
+// "template:<text/template>" rendered with an Entry, e.g.
+// "template:{{.Method}} {{.Path}} {{.Status}} {{.TotalDuration}}".
+func New(w io.Writer, format string) (*Logger, error) {
+	l := &Logger{w: w}
+	switch {
+	case format == "" || format == "json":
+		l.format = FormatJSON
+	case format == "common" || format == "clf":
+		l.format = FormatCommon
+	case format == "combined":
+		l.format = FormatCombined
+	case strings.HasPrefix(format, "template:"):
+		tmpl, err := template.New("access").Parse(strings.TrimPrefix(format, "template:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid access log template: %v", err)
+		}
+		l.format = FormatTemplate
+		l.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	return l, nil
+}
+
+// Log writes e. A nil Logger discards entries, so callers need not check
+// whether access logging is enabled.
+func (l *Logger) Log(e *Entry) {
+	if l == nil {
+		return
+	}
+
+	e = redact(e)
+	var buf bytes.Buffer
+	switch l.format {
+	case FormatCommon:
+		writeCommon(&buf, e)
+	case FormatCombined:
+		writeCommon(&buf, e)
+		fmt.Fprintf(&buf, " %s %s", quote(e.Referer), quote(e.UserAgent))
+	case FormatTemplate:
+		if err := l.tmpl.Execute(&buf, e); err != nil {
+			buf.Reset()
+			fmt.Fprintf(&buf, "access log template error: %v", err)
+		}
+	default:
+		writeJSON(&buf, e)
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// Reopen reopens a file output at its path, for use after an external
+// logrotate moved it away. Other outputs are left alone.
+func (l *Logger) Reopen() error {
+	if l == nil {
+		return nil
+	}
+	r, ok := l.w.(interface{ Reopen() error })
+	if !ok {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return r.Reopen()
+}
+
+// Close closes the output unless it is stdout or stderr. Entries logged
+// afterwards are lost.
+func (l *Logger) Close() error {
+	if l == nil || l.w == os.Stdout || l.w == os.Stderr {
+		return nil
+	}
+	c, ok := l.w.(io.Closer)
+	if !ok {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return c.Close()
+}
+
+// redact returns a copy of e whose client supplied fields went through the
+// application logger's redaction rules, so every format, templates included,
+// writes masked values.
+func redact(e *Entry) *Entry {
+	r := logger.CurrentRedactor()
+	if r == nil {
+		return e
+	}
+	masked := *e
+	masked.User = r.String(e.User)
+	masked.Path = r.String(e.Path)
+	masked.Query = r.Query(e.Query)
+	masked.Referer = r.URL(e.Referer)
+	masked.UserAgent = r.String(e.UserAgent)
+	return &masked
+}
+
+// writeCommon renders the NCSA Common Log Format:
+// host ident authuser [date] "request" status bytes
+func writeCommon(buf *bytes.Buffer, e *Entry) {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+	bytesOut := "-"
+	if e.BytesOut > 0 {
+		bytesOut = strconv.FormatInt(e.BytesOut, 10)
+	}
+	fmt.Fprintf(buf, "%s - %s [%s] \"%s %s %s\" %d %s",
+		dash(e.ClientIP), dash(e.User), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, uri, e.Proto, e.Status, bytesOut)
+}
+
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id,omitempty"`
+	ClientIP   string  `json:"client_ip"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Query      string  `json:"query,omitempty"`
+	Proto      string  `json:"proto"`
+	RouteID    int     `json:"route_id,omitempty"`
+	Service    string  `json:"service,omitempty"`
+	Upstream   string  `json:"upstream,omitempty"`
+	Attempts   int     `json:"attempts,omitempty"`
+	Status     int     `json:"status"`
+	BytesIn    int64   `json:"bytes_in"`
+	BytesOut   int64   `json:"bytes_out"`
+	ResolveMs  float64 `json:"resolve_ms"`
+	UpstreamMs float64 `json:"upstream_ms"`
+	TotalMs    float64 `json:"total_ms"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+}
+
+func writeJSON(buf *bytes.Buffer, e *Entry) {
+	b, _ := json.Marshal(jsonEntry{
+		Time:       e.Time.Format(time.RFC3339Nano),
+		RequestID:  e.RequestID,
+		ClientIP:   e.ClientIP,
+		User:       e.User,
+		Method:     e.Method,
+		Path:       e.Path,
+		Query:      e.Query,
+		Proto:      e.Proto,
+		RouteID:    e.RouteID,
+		Service:    e.Service,
+		Upstream:   e.Upstream,
+		Attempts:   e.Attempts,
+		Status:     e.Status,
+		BytesIn:    e.BytesIn,
+		BytesOut:   e.BytesOut,
+		ResolveMs:  milliseconds(e.ResolveDuration),
+		UpstreamMs: milliseconds(e.UpstreamDuration),
+		TotalMs:    milliseconds(e.TotalDuration),
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+	})
+	buf.Write(b)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying e so the proxy path can fill it in.
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// FromContext returns the entry carried by ctx. When there is none a
+// throwaway entry is returned so callers can always write to it.
+func FromContext(ctx context.Context) *Entry {
+	if e, ok := ctx.Value(contextKey{}).(*Entry); ok {
+		return e
+	}
+	return &Entry{}
+}
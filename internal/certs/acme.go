@@ -0,0 +1,179 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig configures certificate issuance through an ACME server.
+type ACMEConfig struct {
+	DirectoryURL string // e.g. https://acme-v02.api.letsencrypt.org/directory
+	Email        string // contact for expiry notices, optional
+	// CAFile holds extra roots trusted for the ACME server itself, e.g.
+	// Pebble's test CA; empty uses the system roots
+	CAFile      string
+	RenewBefore time.Duration // 0 = 30 days before expiry
+}
+
+// ACME obtains and renews certificates for the hosts its policy allows,
+// answering TLS-ALPN-01 challenges in the handshake and HTTP-01 challenges
+// through HTTPHandler. Certificates, account key and challenge tokens live in
+// the cache, so replicas sharing it share certificates and can answer each
+// other's challenges.
+type ACME struct {
+	manager *autocert.Manager
+	allowed func(host string) bool
+}
+
+func NewACME(config ACMEConfig, cache autocert.Cache, allowed func(host string) bool) (*ACME, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	client := &acme.Client{
+		DirectoryURL: config.DirectoryURL,
+		HTTPClient:   &http.Client{Transport: &orderLocations{next: transport, orders: make(map[string]string)}},
+	}
+
+	a := &ACME{allowed: allowed}
+	a.manager = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       cache,
+		Client:      client,
+		Email:       config.Email,
+		RenewBefore: config.RenewBefore,
+		HostPolicy: func(ctx context.Context, host string) error {
+			// HTTP-01 requests pass the Host header, port included
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			host = strings.ToLower(strings.TrimSuffix(host, "."))
+			if !allowed(host) {
+				return fmt.Errorf("host %q is not served by any route", host)
+			}
+			return nil
+		},
+	}
+	return a, nil
+}
+
+// Allowed reports whether certificates for host may be obtained.
+func (a *ACME) Allowed(host string) bool {
+	return a.allowed(host)
+}
+
+// GetCertificate returns the certificate for the handshake's server name,
+// obtaining it first if needed, or the challenge certificate of a
+// TLS-ALPN-01 validation.
+func (a *ACME) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return a.manager.GetCertificate(hello)
+}
+
+// IsChallenge reports whether hello comes from an ACME server validating a
+// TLS-ALPN-01 challenge.
+func IsChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
+
+// NextProto is the ALPN protocol a TLS config must offer for TLS-ALPN-01.
+const NextProto = acme.ALPNProto
+
+// HTTPHandler answers HTTP-01 challenges and hands every other request to
+// fallback.
+func (a *ACME) HTTPHandler(fallback http.Handler) http.Handler {
+	return a.manager.HTTPHandler(fallback)
+}
+
+// orderLocations works around acme.Client expecting a Location header on
+// finalize responses, which RFC 8555 does not require and CAs finalizing
+// asynchronously (Pebble among them) do not send: without it the client polls
+// an empty URL. The order URL is remembered from the new-order response and
+// added to the matching finalize response.
+type orderLocations struct {
+	next   http.RoundTripper
+	mu     sync.Mutex
+	orders map[string]string // finalize URL -> order URL
+}
+
+func (t *orderLocations) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost || res.StatusCode >= 300 {
+		return res, err
+	}
+
+	if location := res.Header.Get("Location"); location != "" {
+		if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "application/json" {
+			return res, nil
+		}
+		body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		var order struct {
+			Finalize string `json:"finalize"`
+		}
+		if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+			t.mu.Lock()
+			t.orders[order.Finalize] = location
+			t.mu.Unlock()
+		}
+		return res, nil
+	}
+
+	t.mu.Lock()
+	location, ok := t.orders[req.URL.String()]
+	delete(t.orders, req.URL.String())
+	t.mu.Unlock()
+	if ok {
+		res.Header.Set("Location", location)
+	}
+	return res, nil
+}
+
+// Obtain fetches certificates for hosts up front instead of in the first
+// handshake, so clients do not wait for issuance. Certificates already in
+// the cache are only loaded; autocert renews each one before it expires.
+func (a *ACME) Obtain(hosts []string) {
+	for _, host := range hosts {
+		// Signal ECDSA support so the certificate clients get is the one
+		// obtained here rather than an RSA fallback
+		hello := &tls.ClientHelloInfo{
+			ServerName:       host,
+			SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedCurves:  []tls.CurveID{tls.CurveP256},
+			CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}
+		cert, err := a.manager.GetCertificate(hello)
+		if err != nil {
+			logger.Error("Failed to obtain ACME certificate", err, "host", host)
+			continue
+		}
+		logger.Info("ACME certificate ready", "host", host, "not_after", cert.Leaf.NotAfter)
+	}
+}
@@ -0,0 +1,324 @@
+// Package certs serves TLS certificates from files and other sources, picks
+// one per handshake by SNI and reloads them while the gateway runs.
+package certs
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// KeyPair is a PEM encoded certificate chain and its private key. Source
+// names where it came from, for logs and metrics.
+type KeyPair struct {
+	Source  string
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// Loader returns the current key pairs of one source.
+type Loader func(ctx context.Context) ([]KeyPair, error)
+
+// Files loads certificate and key files given pairwise.
+func Files(certFiles, keyFiles []string) Loader {
+	return func(ctx context.Context) ([]KeyPair, error) {
+		if len(certFiles) != len(keyFiles) {
+			return nil, fmt.Errorf("got %d certificate files but %d key files", len(certFiles), len(keyFiles))
+		}
+		pairs := make([]KeyPair, 0, len(certFiles))
+		for i := range certFiles {
+			certPEM, err := os.ReadFile(certFiles[i])
+			if err != nil {
+				return nil, err
+			}
+			keyPEM, err := os.ReadFile(keyFiles[i])
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, KeyPair{Source: certFiles[i], CertPEM: certPEM, KeyPEM: keyPEM})
+		}
+		return pairs, nil
+	}
+}
+
+// Info describes a loaded certificate.
+type Info struct {
+	Source   string    `json:"source"`
+	Names    []string  `json:"names"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// Store holds the certificates of all sources. The first certificate loaded
+// is the default for handshakes without SNI or for unknown names.
+type Store struct {
+	loaders []Loader
+	// reloading serialises Reload. loaded keeps each loader's last pairs so
+	// a source that is briefly unavailable (e.g. the database) does not drop
+	// its certificates.
+	reloading sync.Mutex
+	loaded    [][]KeyPair
+
+	mu       sync.RWMutex
+	byName   map[string][]*tls.Certificate
+	fallback *tls.Certificate
+	infos    []Info
+	digest   [sha256.Size]byte
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewStore(loaders ...Loader) *Store {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Store{
+		loaders: loaders,
+		loaded:  make([][]KeyPair, len(loaders)),
+		byName:  make(map[string][]*tls.Certificate),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Reload loads every source and swaps in the result when anything changed.
+// A failing source keeps its previous pairs and pairs that fail to parse
+// are skipped, both reported in the error; the previous certificates stay
+// in place when pairs were found but none is usable.
+func (s *Store) Reload(ctx context.Context) (bool, error) {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+
+	var pairs []KeyPair
+	var errs []error
+	for i, load := range s.loaders {
+		loaded, err := load(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			loaded = s.loaded[i]
+		}
+		s.loaded[i] = loaded
+		pairs = append(pairs, loaded...)
+	}
+
+	h := sha256.New()
+	for _, p := range pairs {
+		h.Write([]byte(p.Source))
+		h.Write(p.CertPEM)
+		h.Write(p.KeyPEM)
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	s.mu.RLock()
+	unchanged := digest == s.digest
+	s.mu.RUnlock()
+	if unchanged {
+		return false, errors.Join(errs...)
+	}
+
+	byName := make(map[string][]*tls.Certificate)
+	var fallback *tls.Certificate
+	var infos []Info
+	for _, p := range pairs {
+		cert, err := tls.X509KeyPair(p.CertPEM, p.KeyPEM)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p.Source, err))
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p.Source, err))
+			continue
+		}
+		cert.Leaf = leaf
+
+		names := certificateNames(leaf)
+		for _, name := range names {
+			byName[name] = append(byName[name], &cert)
+		}
+		if fallback == nil {
+			fallback = &cert
+		}
+		infos = append(infos, Info{Source: p.Source, Names: names, NotAfter: leaf.NotAfter})
+	}
+	if fallback == nil && len(pairs) > 0 {
+		errs = append(errs, errors.New("no usable certificate"))
+		return false, errors.Join(errs...)
+	}
+
+	s.mu.Lock()
+	s.byName = byName
+	s.fallback = fallback
+	s.infos = infos
+	s.digest = digest
+	s.mu.Unlock()
+	return true, errors.Join(errs...)
+}
+
+// certificateNames returns the lower-cased DNS names of a certificate,
+// falling back to its common name when it has no SANs.
+func certificateNames(leaf *x509.Certificate) []string {
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+	for _, ip := range leaf.IPAddresses {
+		names = append(names, ip.String())
+	}
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// GetCertificate implements tls.Config.GetCertificate: an exact name match
+// wins over a wildcard, and among several certificates for a name the first
+// one the client supports (e.g. ECDSA vs RSA) is used.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, ok := s.Lookup(hello)
+	if !ok {
+		s.mu.RLock()
+		cert = s.fallback
+		s.mu.RUnlock()
+	}
+	if cert == nil {
+		return nil, errors.New("no certificate available")
+	}
+	return cert, nil
+}
+
+// Lookup finds a certificate for the handshake's server name without
+// falling back to the default certificate.
+func (s *Store) Lookup(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" && hello.Conn != nil {
+		// Clients connecting by IP send no SNI
+		name = hostOnly(hello.Conn.LocalAddr().String())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	candidates := s.byName[name]
+	if len(candidates) == 0 {
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			candidates = s.byName["*."+parent]
+		}
+	}
+	for _, cert := range candidates {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, true
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0], true
+	}
+	return nil, false
+}
+
+func hostOnly(addr string) string {
+	if i := strings.LastIndexByte(addr, ':'); i >= 0 {
+		addr = addr[:i]
+	}
+	return strings.Trim(addr, "[]")
+}
+
+// Certificates returns the loaded certificates ordered by expiry.
+func (s *Store) Certificates() []Info {
+	s.mu.RLock()
+	infos := append([]Info(nil), s.infos...)
+	s.mu.RUnlock()
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].NotAfter.Before(infos[j].NotAfter) })
+	return infos
+}
+
+// Watch reloads the certificates every interval until Stop is called, so
+// renewed certificates are picked up without a restart.
+func (s *Store) Watch(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.reloadAndLog()
+			}
+		}
+	}()
+}
+
+// ReloadNow reloads immediately, e.g. on SIGHUP, and logs the outcome.
+func (s *Store) ReloadNow() {
+	s.reloadAndLog()
+}
+
+func (s *Store) reloadAndLog() {
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+	changed, err := s.Reload(ctx)
+	if err != nil {
+		logger.Error("Failed to reload TLS certificates", err)
+	}
+	if changed {
+		logger.Info("Reloaded TLS certificates", "count", len(s.Certificates()))
+	}
+}
+
+// Stop ends Watch.
+func (s *Store) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// ParseVersion maps "1.0" to "1.3" to a tls.Version* constant.
+func ParseVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "", "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q", v)
+	}
+}
+
+// ParseCipherSuites maps comma separated IANA suite names, e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, to their IDs. Insecure suites are
+// rejected. An empty list leaves the choice to Go's defaults. TLS 1.3 suites
+// are not configurable.
+func ParseCipherSuites(list string) ([]uint16, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
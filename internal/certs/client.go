@@ -0,0 +1,119 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadCAs reads a PEM bundle of CA certificates.
+func LoadCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return pool, nil
+}
+
+// VerifyClient checks the certificate a client presented in the handshake
+// against roots and returns it. The TLS listener only requests certificates,
+// since which CA applies depends on the route; this is where they are
+// verified.
+func VerifyClient(state *tls.ConnectionState, roots *x509.CertPool) (*x509.Certificate, error) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no client certificate presented")
+	}
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// SANs lists the subject alternative names of cert as TYPE:value, e.g.
+// DNS:api.partner.com or URI:spiffe://partner/billing.
+func SANs(cert *x509.Certificate) []string {
+	var sans []string
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	return sans
+}
+
+// MatchIdentity reports whether cert's common name or any of its SANs
+// matches one of patterns. Patterns are compared case-insensitively and may
+// start with "*." to match any subdomain; an empty list accepts any
+// certificate.
+func MatchIdentity(cert *x509.Certificate, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	identities := []string{cert.Subject.CommonName}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, identity := range identities {
+			identity = strings.ToLower(identity)
+			if identity == "" {
+				continue
+			}
+			if identity == pattern {
+				return true
+			}
+			if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") &&
+				strings.HasSuffix(identity, suffix) && len(identity) > len(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type verifiedClientKey struct{}
+
+// WithVerifiedClient returns a context recording that cert passed
+// VerifyClient and MatchIdentity for the request's route.
+func WithVerifiedClient(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, verifiedClientKey{}, cert)
+}
+
+// VerifiedClient returns the client certificate verified for the request,
+// or nil when none was.
+func VerifiedClient(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(verifiedClientKey{}).(*x509.Certificate)
+	return cert
+}
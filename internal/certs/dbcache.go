@@ -0,0 +1,39 @@
+package certs
+
+import (
+	"context"
+	"database/sql"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DBCache stores ACME data in the acme_cache table so every gateway replica
+// sees the same account, certificates and challenge tokens.
+type DBCache struct {
+	db *sql.DB
+}
+
+func NewDBCache(db *sql.DB) *DBCache {
+	return &DBCache{db: db}
+}
+
+func (c *DBCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := c.db.QueryRowContext(ctx, `SELECT data FROM acme_cache WHERE key = $1`, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, err
+}
+
+func (c *DBCache) Put(ctx context.Context, key string, data []byte) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO acme_cache (key, data) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, updated_at = NOW()`, key, data)
+	return err
+}
+
+func (c *DBCache) Delete(ctx context.Context, key string) error {
+	_, err := c.db.ExecContext(ctx, `DELETE FROM acme_cache WHERE key = $1`, key)
+	return err
+}
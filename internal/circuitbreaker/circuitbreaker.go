@@ -0,0 +1,245 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// ErrOpen is returned by Allow while the breaker rejects requests.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is the result of a request admitted by Allow.
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	// Ignored releases the request without counting it either way, for
+	// requests that never reached the upstream or were abandoned by the
+	// client
+	Ignored
+)
+
+// Config controls when a breaker opens and how it recovers.
+type Config struct {
+	// FailureThreshold opens the breaker after this many consecutive failures.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before probing again.
+	Cooldown time.Duration
+	// HalfOpenMaxRequests is the number of concurrent probe requests allowed
+	// while half-open.
+	HalfOpenMaxRequests int
+	// SuccessThreshold closes a half-open breaker after this many successes.
+	SuccessThreshold int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FailureThreshold:    5,
+		Cooldown:            30 * time.Second,
+		HalfOpenMaxRequests: 1,
+		SuccessThreshold:    2,
+	}
+}
+
+// StateChangeFunc is notified of every state transition.
+type StateChangeFunc func(name string, from, to State)
+
+// Breaker is a circuit breaker for a single upstream.
+type Breaker struct {
+	name     string
+	cfg      Config
+	onChange StateChangeFunc
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64
+	failures    int
+	successes   int
+	inFlight    int
+	openedAt    time.Time
+	transitions int
+}
+
+// Allow reports whether a request may proceed. When it may, the returned
+// function must be called exactly once with the outcome of the request.
+func (b *Breaker) Allow() (func(outcome Outcome), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == StateOpen {
+		if now.Sub(b.openedAt) < b.cfg.Cooldown {
+			return nil, ErrOpen
+		}
+		b.setState(StateHalfOpen, now)
+	}
+	if b.state == StateHalfOpen {
+		if b.inFlight >= b.cfg.HalfOpenMaxRequests {
+			return nil, ErrOpen
+		}
+		b.inFlight++
+	}
+
+	generation := b.generation
+	return func(outcome Outcome) { b.done(generation, outcome) }, nil
+}
+
+// RetryAfter returns how long until an open breaker starts probing again.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	remaining := b.cfg.Cooldown - time.Since(b.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (b *Breaker) done(generation uint64, outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Outcomes of requests admitted before the last transition do not count
+	if generation != b.generation {
+		return
+	}
+
+	now := time.Now()
+	switch b.state {
+	case StateClosed:
+		if outcome == Ignored {
+			return
+		}
+		if outcome == Success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		if outcome == Ignored {
+			return
+		}
+		if outcome == Failure {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.SuccessThreshold {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.successes = 0
+	b.inFlight = 0
+	b.transitions++
+	if state == StateOpen {
+		b.openedAt = now
+	}
+
+	logger.Warn("Circuit breaker state changed", "upstream", b.name, "from", from.String(), "to", state.String())
+	if b.onChange != nil {
+		b.onChange(b.name, from, state)
+	}
+}
+
+// Status is a point-in-time view of a breaker for status output.
+type Status struct {
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Failures    int    `json:"consecutive_failures"`
+	Transitions int    `json:"transitions"`
+}
+
+// Set holds one breaker per upstream name, created on first use.
+type Set struct {
+	cfg      Config
+	onChange StateChangeFunc
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewSet(cfg Config, onChange StateChangeFunc) *Set {
+	return &Set{
+		cfg:      cfg,
+		onChange: onChange,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker for an upstream, creating it if needed.
+func (s *Set) Get(name string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[name]
+	if !ok {
+		b = &Breaker{name: name, cfg: s.cfg, onChange: s.onChange}
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// Status returns the state of every breaker.
+func (s *Set) Status() []Status {
+	s.mu.Lock()
+	breakers := make([]*Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	result := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		b.mu.Lock()
+		result = append(result, Status{
+			Name:        b.name,
+			State:       b.state.String(),
+			Failures:    b.failures,
+			Transitions: b.transitions,
+		})
+		b.mu.Unlock()
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
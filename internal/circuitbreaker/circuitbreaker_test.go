@@ -0,0 +1,141 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type transition struct{ from, to State }
+
+func newTestBreaker(t *testing.T) (*Breaker, *[]transition) {
+	t.Helper()
+	var transitions []transition
+	set := NewSet(Config{
+		FailureThreshold:    3,
+		Cooldown:            50 * time.Millisecond,
+		HalfOpenMaxRequests: 1,
+		SuccessThreshold:    2,
+	}, func(name string, from, to State) {
+		if name != "svc" {
+			t.Errorf("transition reported for %q, want svc", name)
+		}
+		transitions = append(transitions, transition{from, to})
+	})
+	return set.Get("svc"), &transitions
+}
+
+func request(t *testing.T, b *Breaker, outcome Outcome) {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow error = %v, want the request admitted", err)
+	}
+	done(outcome)
+}
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	b, transitions := newTestBreaker(t)
+	request(t, b, Failure)
+	request(t, b, Failure)
+	request(t, b, Success) // resets the streak
+	request(t, b, Failure)
+	request(t, b, Failure)
+	request(t, b, Ignored) // neither resets nor counts
+	request(t, b, Failure)
+
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow error = %v, want ErrOpen", err)
+	}
+	if retry := b.RetryAfter(); retry <= 0 || retry > 50*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want within the cooldown", retry)
+	}
+	if want := []transition{{StateClosed, StateOpen}}; !reflect.DeepEqual(*transitions, want) {
+		t.Errorf("transitions = %v, want %v", *transitions, want)
+	}
+}
+
+func TestHalfOpenRecovery(t *testing.T) {
+	b, transitions := newTestBreaker(t)
+	for i := 0; i < 3; i++ {
+		request(t, b, Failure)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// One probe at a time while half-open
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow after the cooldown error = %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second concurrent probe error = %v, want ErrOpen", err)
+	}
+	done(Ignored) // frees the probe slot without deciding
+	request(t, b, Success)
+	request(t, b, Success)
+
+	request(t, b, Success)
+	want := []transition{{StateClosed, StateOpen}, {StateOpen, StateHalfOpen}, {StateHalfOpen, StateClosed}}
+	if !reflect.DeepEqual(*transitions, want) {
+		t.Errorf("transitions = %v, want %v", *transitions, want)
+	}
+}
+
+func TestHalfOpenFailureReopens(t *testing.T) {
+	b, transitions := newTestBreaker(t)
+	for i := 0; i < 3; i++ {
+		request(t, b, Failure)
+	}
+	time.Sleep(60 * time.Millisecond)
+	request(t, b, Failure)
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow error = %v after a failed probe, want ErrOpen", err)
+	}
+	want := []transition{{StateClosed, StateOpen}, {StateOpen, StateHalfOpen}, {StateHalfOpen, StateOpen}}
+	if !reflect.DeepEqual(*transitions, want) {
+		t.Errorf("transitions = %v, want %v", *transitions, want)
+	}
+}
+
+func TestStaleOutcomesIgnored(t *testing.T) {
+	b, _ := newTestBreaker(t)
+	// Admitted while closed, finishing after the breaker opened
+	slow, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		request(t, b, Failure)
+	}
+	time.Sleep(60 * time.Millisecond)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow(Success)
+	if state := b.state; state != StateHalfOpen {
+		t.Fatalf("state = %s after a stale success, want half-open", state)
+	}
+	probe(Failure)
+	if state := b.state; state != StateOpen {
+		t.Errorf("state = %s after the probe failed, want open", state)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	set := NewSet(Config{FailureThreshold: 1, Cooldown: time.Minute, HalfOpenMaxRequests: 1, SuccessThreshold: 1}, nil)
+	done, _ := set.Get("b").Allow()
+	done(Failure)
+	set.Get("a")
+	if set.Get("a") != set.Get("a") {
+		t.Fatal("Get returned different breakers for the same name")
+	}
+	want := []Status{
+		{Name: "a", State: "closed"},
+		{Name: "b", State: "open", Transitions: 1},
+	}
+	if got := set.Status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Status = %+v, want %+v", got, want)
+	}
+}
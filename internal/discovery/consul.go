@@ -1,14 +1,23 @@
 package discovery
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 
 	"github.com/Antimatterr/psygateway/internal/logger"
 	"github.com/hashicorp/consul/api"
 )
 
+// ErrNoHealthyInstances is returned when a service has no passing instance.
+var ErrNoHealthyInstances = errors.New("no healthy instances")
+
 type ServiceDiscovery struct {
-	client *api.Client
+	client    *api.Client
+	transport *http.Transport
 }
 
 func NewServiceDiscovery(consulAddress string) (*ServiceDiscovery, error) {
@@ -26,7 +35,13 @@ func NewServiceDiscovery(consulAddress string) (*ServiceDiscovery, error) {
 		return nil, err
 	}
 
-	return &ServiceDiscovery{client: client}, nil
+	return &ServiceDiscovery{client: client, transport: config.Transport}, nil
+}
+
+// Close releases the client's pooled connections to the Consul agent. The
+// client must not be used afterwards.
+func (sd *ServiceDiscovery) Close() {
+	sd.transport.CloseIdleConnections()
 }
 
 func (sd *ServiceDiscovery) RegisterService(serviceName, address string, port int, healthCheckPath string) error {
@@ -58,15 +73,61 @@ func (sd *ServiceDiscovery) GetHealthyService(serviceName string) (string, error
 	}
 
 	if len(services) == 0 {
-		return "", fmt.Errorf("no healthy services found for %s", serviceName)
+		return "", fmt.Errorf("%w found for %s", ErrNoHealthyInstances, serviceName)
 	}
 
 	//need load balancing here as there can be multiple healthy services instances
 	//for simplicity, returning the first healthy service instance
 
 	// Return full HTTP URL
-	serviceURL := fmt.Sprintf("http://%s:%d", services[0].Service.Address, services[0].Service.Port)
+	serviceURL := instanceURL(services[0].Service)
 	logger.Info("Found healthy service", "service", serviceName, "url", serviceURL)
 
 	return serviceURL, nil
 }
+
+// GetHealthyServices returns the URLs of every passing instance of a service
+// so the caller can load balance across them. The Consul query is bound to
+// ctx, which also supplies the request-scoped logger.
+func (sd *ServiceDiscovery) GetHealthyServices(ctx context.Context, serviceName string) ([]string, error) {
+	q := (&api.QueryOptions{}).WithContext(ctx)
+	services, _, err := sd.client.Health().Service(serviceName, "", true, q)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to get healthy services", err, "service", serviceName)
+		return nil, err
+	}
+
+	if len(services) == 0 {
+		return nil, fmt.Errorf("%w found for %s", ErrNoHealthyInstances, serviceName)
+	}
+
+	urls := make([]string, 0, len(services))
+	for _, entry := range services {
+		urls = append(urls, instanceURL(entry.Service))
+	}
+	return urls, nil
+}
+
+// SchemeMeta is the service meta key through which an instance asks to be
+// called over TLS ("https"); instances without it are called over plain HTTP.
+const SchemeMeta = "scheme"
+
+func instanceURL(service *api.AgentService) string {
+	scheme := "http"
+	if service.Meta[SchemeMeta] == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(service.Address, strconv.Itoa(service.Port)))
+}
+
+// Ping checks that the Consul agent answers and the cluster has a leader.
+func (sd *ServiceDiscovery) Ping(ctx context.Context) error {
+	leader, err := sd.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if leader == "" {
+		return errors.New("consul cluster has no leader")
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package discovery
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+	"github.com/hashicorp/consul/api"
+)
+
+// Registration describes a service instance to be registered with Consul.
+type Registration struct {
+	ServiceName     string
+	Address         string
+	Port            int
+	HealthCheckPath string
+	Tags            []string
+	Meta            map[string]string // SchemeMeta "https" = the gateway calls this instance over TLS
+
+	// TTL switches the check from an HTTP check to a TTL check that the
+	// registrar keeps passing with heartbeats. Zero means HTTP check.
+	TTL time.Duration
+
+	// CheckInterval is how often the registrar verifies that the agent still
+	// knows about this instance (and re-registers it if not).
+	CheckInterval time.Duration
+
+	// MaxRetries bounds the initial registration attempts. Zero means 5.
+	MaxRetries int
+}
+
+// Registrar owns the registration lifecycle of a single service instance:
+// registering with retries, re-registering after Consul restarts, keeping
+// TTL checks alive and deregistering on shutdown.
+type Registrar struct {
+	sd   *ServiceDiscovery
+	reg  Registration
+	id   string
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+
+	mu      sync.Mutex
+	started bool // maintain is running and will close done
+}
+
+// NewRegistrar creates a registrar for the given registration with a unique
+// instance ID. Nothing is sent to Consul until Start is called.
+func (sd *ServiceDiscovery) NewRegistrar(reg Registration) *Registrar {
+	if reg.CheckInterval <= 0 {
+		reg.CheckInterval = 15 * time.Second
+	}
+	if reg.MaxRetries <= 0 {
+		reg.MaxRetries = 5
+	}
+	return &Registrar{
+		sd:   sd,
+		reg:  reg,
+		id:   instanceID(reg.ServiceName, reg.Address, reg.Port),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// ID returns the unique Consul service ID of this instance.
+func (r *Registrar) ID() string {
+	return r.id
+}
+
+// Start registers the instance, retrying with exponential backoff, and then
+// launches the background maintenance loop.
+func (r *Registrar) Start() error {
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= r.reg.MaxRetries; attempt++ {
+		if err = r.register(); err == nil {
+			break
+		}
+		logger.Warn("Service registration failed, retrying", "service", r.reg.ServiceName, "attempt", attempt, "error", err)
+		if attempt == r.reg.MaxRetries {
+			return fmt.Errorf("failed to register %s after %d attempts: %v", r.id, attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+
+	logger.Info("Registered service with Consul", "service", r.reg.ServiceName, "id", r.id)
+	r.mu.Lock()
+	r.started = true
+	go r.maintain()
+	r.mu.Unlock()
+	return nil
+}
+
+// Stop halts the maintenance loop and deregisters the instance. It does not
+// block when Start failed or was never called.
+func (r *Registrar) Stop() error {
+	r.once.Do(func() {
+		r.mu.Lock()
+		close(r.stop)
+		started := r.started
+		r.mu.Unlock()
+		if started {
+			<-r.done
+		}
+	})
+	if err := r.sd.DeregisterService(r.id); err != nil {
+		return fmt.Errorf("failed to deregister %s: %v", r.id, err)
+	}
+	logger.Info("Deregistered service from Consul", "service", r.reg.ServiceName, "id", r.id)
+	return nil
+}
+
+func (r *Registrar) register() error {
+	registration := &api.AgentServiceRegistration{
+		ID:      r.id,
+		Name:    r.reg.ServiceName,
+		Address: r.reg.Address,
+		Port:    r.reg.Port,
+		Tags:    r.reg.Tags,
+		Meta:    r.reg.Meta,
+		Check:   r.check(),
+	}
+	if err := r.sd.client.Agent().ServiceRegister(registration); err != nil {
+		return err
+	}
+	if r.reg.TTL > 0 {
+		return r.heartbeat()
+	}
+	return nil
+}
+
+func (r *Registrar) check() *api.AgentServiceCheck {
+	if r.reg.TTL > 0 {
+		return &api.AgentServiceCheck{
+			CheckID:                        r.checkID(),
+			TTL:                            r.reg.TTL.String(),
+			DeregisterCriticalServiceAfter: "1m",
+		}
+	}
+	scheme := "http"
+	if r.reg.Meta[SchemeMeta] == "https" {
+		scheme = "https"
+	}
+	return &api.AgentServiceCheck{
+		CheckID:                        r.checkID(),
+		HTTP:                           fmt.Sprintf("%s://%s:%d%s", scheme, r.reg.Address, r.reg.Port, r.reg.HealthCheckPath),
+		Interval:                       "10s",
+		Timeout:                        "5s",
+		DeregisterCriticalServiceAfter: "1m",
+	}
+}
+
+func (r *Registrar) checkID() string {
+	return "service:" + r.id
+}
+
+func (r *Registrar) heartbeat() error {
+	return r.sd.client.Agent().UpdateTTL(r.checkID(), "", api.HealthPassing)
+}
+
+// maintain keeps the registration alive. With a TTL check it heartbeats at
+// half the TTL; in every mode it periodically verifies the agent still has
+// the instance, which is not the case after a Consul agent restart.
+func (r *Registrar) maintain() {
+	defer close(r.done)
+
+	interval := r.reg.CheckInterval
+	if r.reg.TTL > 0 && r.reg.TTL/2 < interval {
+		interval = r.reg.TTL / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			services, err := r.sd.client.Agent().Services()
+			if err != nil {
+				logger.Warn("Failed to query Consul agent services", "service", r.reg.ServiceName, "error", err)
+				continue
+			}
+			if _, ok := services[r.id]; !ok {
+				logger.Warn("Service missing from Consul, re-registering", "service", r.reg.ServiceName, "id", r.id)
+				if err := r.register(); err != nil {
+					logger.Error("Failed to re-register service", "service", r.reg.ServiceName, "error", err)
+				}
+				continue
+			}
+			if r.reg.TTL > 0 {
+				if err := r.heartbeat(); err != nil {
+					logger.Warn("Failed to update TTL check", "service", r.reg.ServiceName, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// instanceID builds a Consul service ID that is unique per process, so that
+// several replicas sharing a container name do not overwrite each other.
+func instanceID(serviceName, address string, port int) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%s-%d-%d", serviceName, address, port, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%s-%d-%s", serviceName, address, port, hex.EncodeToString(suffix))
+}
@@ -0,0 +1,93 @@
+package gatewayerr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Code is a stable, machine-readable error identifier returned to clients.
+type Code string
+
+const (
+	CodeBadRequest           Code = "BAD_REQUEST"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeClientCertificate    Code = "CLIENT_CERTIFICATE_REQUIRED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeRouteNotFound        Code = "ROUTE_NOT_FOUND"
+	CodeInternal             Code = "INTERNAL_ERROR"
+	CodeBadGateway           Code = "BAD_GATEWAY"
+	CodeConnectionRefused    Code = "UPSTREAM_CONNECTION_REFUSED"
+	CodeUpstreamTLS          Code = "UPSTREAM_TLS_ERROR"
+	CodeNoHealthyUpstream    Code = "NO_HEALTHY_UPSTREAM"
+	CodeDiscoveryUnavailable Code = "DISCOVERY_UNAVAILABLE"
+	CodeCircuitOpen          Code = "CIRCUIT_OPEN"
+	CodeUpstreamTimeout      Code = "UPSTREAM_TIMEOUT"
+	CodeClientClosedRequest  Code = "CLIENT_CLOSED_REQUEST"
+)
+
+// StatusClientClosedRequest is the non-standard status (popularised by
+// nginx) recorded when the client disconnects before a response is ready.
+const StatusClientClosedRequest = 499
+
+// Error is a failure that maps to a gateway response.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Err     error
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap is like New but keeps the underlying cause for logging.
+func Wrap(err error, status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Upstream classifies an error returned while calling an upstream:
+// timeouts map to 504, refused connections and any other transport or
+// protocol failure map to 502.
+func Upstream(err error) *Error {
+	var netErr net.Error
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Wrap(err, StatusClientClosedRequest, CodeClientClosedRequest, "Client closed the request")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return Wrap(err, http.StatusGatewayTimeout, CodeUpstreamTimeout, "Upstream service did not respond in time")
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return Wrap(err, http.StatusBadGateway, CodeConnectionRefused, "Upstream service refused the connection")
+	case errors.As(err, &verifyErr), errors.As(err, &alertErr):
+		// Untrusted server certificate, or the upstream rejected ours
+		return Wrap(err, http.StatusBadGateway, CodeUpstreamTLS, "TLS handshake with upstream service failed")
+	default:
+		return Wrap(err, http.StatusBadGateway, CodeBadGateway, "Invalid response from upstream service")
+	}
+}
+
+// StatusText is http.StatusText extended with the gateway's own statuses.
+func StatusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
@@ -0,0 +1,158 @@
+package gatewayerr
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GRPCCode is a gRPC status code as sent in the grpc-status trailer.
+type GRPCCode int
+
+const (
+	GRPCOK                 GRPCCode = 0
+	GRPCCanceled           GRPCCode = 1
+	GRPCUnknown            GRPCCode = 2
+	GRPCInvalidArgument    GRPCCode = 3
+	GRPCDeadlineExceeded   GRPCCode = 4
+	GRPCNotFound           GRPCCode = 5
+	GRPCAlreadyExists      GRPCCode = 6
+	GRPCPermissionDenied   GRPCCode = 7
+	GRPCResourceExhausted  GRPCCode = 8
+	GRPCFailedPrecondition GRPCCode = 9
+	GRPCAborted            GRPCCode = 10
+	GRPCOutOfRange         GRPCCode = 11
+	GRPCUnimplemented      GRPCCode = 12
+	GRPCInternal           GRPCCode = 13
+	GRPCUnavailable        GRPCCode = 14
+	GRPCDataLoss           GRPCCode = 15
+	GRPCUnauthenticated    GRPCCode = 16
+)
+
+// grpcNames and grpcHTTPStatus describe each gRPC code for JSON clients; the
+// statuses follow the mapping used by grpc-gateway and Google APIs.
+var (
+	grpcNames = map[GRPCCode]string{
+		GRPCOK:                 "OK",
+		GRPCCanceled:           "CANCELLED",
+		GRPCUnknown:            "UNKNOWN",
+		GRPCInvalidArgument:    "INVALID_ARGUMENT",
+		GRPCDeadlineExceeded:   "DEADLINE_EXCEEDED",
+		GRPCNotFound:           "NOT_FOUND",
+		GRPCAlreadyExists:      "ALREADY_EXISTS",
+		GRPCPermissionDenied:   "PERMISSION_DENIED",
+		GRPCResourceExhausted:  "RESOURCE_EXHAUSTED",
+		GRPCFailedPrecondition: "FAILED_PRECONDITION",
+		GRPCAborted:            "ABORTED",
+		GRPCOutOfRange:         "OUT_OF_RANGE",
+		GRPCUnimplemented:      "UNIMPLEMENTED",
+		GRPCInternal:           "INTERNAL",
+		GRPCUnavailable:        "UNAVAILABLE",
+		GRPCDataLoss:           "DATA_LOSS",
+		GRPCUnauthenticated:    "UNAUTHENTICATED",
+	}
+	grpcHTTPStatus = map[GRPCCode]int{
+		GRPCOK:                 http.StatusOK,
+		GRPCCanceled:           StatusClientClosedRequest,
+		GRPCUnknown:            http.StatusInternalServerError,
+		GRPCInvalidArgument:    http.StatusBadRequest,
+		GRPCDeadlineExceeded:   http.StatusGatewayTimeout,
+		GRPCNotFound:           http.StatusNotFound,
+		GRPCAlreadyExists:      http.StatusConflict,
+		GRPCPermissionDenied:   http.StatusForbidden,
+		GRPCResourceExhausted:  http.StatusTooManyRequests,
+		GRPCFailedPrecondition: http.StatusBadRequest,
+		GRPCAborted:            http.StatusConflict,
+		GRPCOutOfRange:         http.StatusBadRequest,
+		GRPCUnimplemented:      http.StatusNotImplemented,
+		GRPCInternal:           http.StatusInternalServerError,
+		GRPCUnavailable:        http.StatusServiceUnavailable,
+		GRPCDataLoss:           http.StatusInternalServerError,
+		GRPCUnauthenticated:    http.StatusUnauthorized,
+	}
+)
+
+func (c GRPCCode) String() string {
+	if name, ok := grpcNames[c]; ok {
+		return name
+	}
+	return "CODE_" + strconv.Itoa(int(c))
+}
+
+// FromGRPC converts a gRPC status returned by an upstream into an error for
+// JSON clients, with the status name (NOT_FOUND, ...) as its code.
+func FromGRPC(code GRPCCode, message string) *Error {
+	status, ok := grpcHTTPStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if message == "" {
+		message = fmt.Sprintf("Upstream call failed with %s", code)
+	}
+	return New(status, Code(code.String()), message)
+}
+
+// GRPCCode maps e to the gRPC status a client should see. The gateway's own
+// codes are more precise than the HTTP status; anything else follows the
+// standard HTTP to gRPC mapping that gRPC clients apply to a non-gRPC
+// response, where even a 400 means the server misbehaved.
+func (e *Error) GRPCCode() GRPCCode {
+	switch e.Code {
+	case CodeBadRequest:
+		return GRPCInvalidArgument
+	case CodeForbidden:
+		return GRPCPermissionDenied
+	case CodeClientClosedRequest:
+		return GRPCCanceled
+	case CodeUpstreamTimeout:
+		return GRPCDeadlineExceeded
+	case CodeRouteNotFound:
+		return GRPCUnimplemented
+	case CodeUnauthorized, CodeClientCertificate:
+		return GRPCUnauthenticated
+	case CodeConnectionRefused, CodeUpstreamTLS, CodeNoHealthyUpstream, CodeDiscoveryUnavailable, CodeCircuitOpen, CodeBadGateway:
+		return GRPCUnavailable
+	case CodeInternal:
+		return GRPCInternal
+	}
+
+	switch e.Status {
+	case http.StatusBadRequest:
+		return GRPCInternal
+	case http.StatusUnauthorized:
+		return GRPCUnauthenticated
+	case http.StatusForbidden:
+		return GRPCPermissionDenied
+	case http.StatusNotFound:
+		return GRPCUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GRPCUnavailable
+	default:
+		return GRPCUnknown
+	}
+}
+
+// WriteGRPC sends e to a gRPC client as a trailers-only response: HTTP 200
+// without a body, the status in grpc-status and the message in grpc-message.
+func WriteGRPC(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(e.GRPCCode())))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(fmt.Sprintf("%s: %s", e.Code, e.Message)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes the bytes grpc-message may not carry
+// verbatim: anything outside printable ASCII and the percent sign itself.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package gatewayerr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want GRPCCode
+	}{
+		{New(http.StatusBadRequest, CodeBadRequest, "bad field"), GRPCInvalidArgument},
+		{New(http.StatusForbidden, CodeForbidden, "no"), GRPCPermissionDenied},
+		{New(http.StatusUnauthorized, CodeClientCertificate, "no cert"), GRPCUnauthenticated},
+		{New(http.StatusNotFound, CodeRouteNotFound, "none"), GRPCUnimplemented},
+		{New(http.StatusServiceUnavailable, CodeCircuitOpen, "open"), GRPCUnavailable},
+		{Upstream(context.DeadlineExceeded), GRPCDeadlineExceeded},
+		{Upstream(context.Canceled), GRPCCanceled},
+		{Upstream(errors.New("EOF")), GRPCUnavailable},
+
+		// Codes the gateway does not know fall back to the HTTP status
+		{New(http.StatusBadRequest, "UPSTREAM_SPECIFIC", "x"), GRPCInternal},
+		{New(http.StatusTooManyRequests, "RATE_LIMITED", "x"), GRPCUnavailable},
+		{New(http.StatusTeapot, "TEAPOT", "x"), GRPCUnknown},
+	}
+	for _, tt := range tests {
+		if got := tt.err.GRPCCode(); got != tt.want {
+			t.Errorf("GRPCCode() of %d %s = %s, want %s", tt.err.Status, tt.err.Code, got, tt.want)
+		}
+	}
+}
+
+func TestFromGRPC(t *testing.T) {
+	e := FromGRPC(GRPCNotFound, "")
+	if e.Status != http.StatusNotFound || e.Code != "NOT_FOUND" || e.Message != "Upstream call failed with NOT_FOUND" {
+		t.Errorf("FromGRPC(NOT_FOUND) = %d %s %q", e.Status, e.Code, e.Message)
+	}
+	if e := FromGRPC(GRPCCode(99), "odd"); e.Status != http.StatusInternalServerError || e.Code != "CODE_99" {
+		t.Errorf("FromGRPC(99) = %d %s", e.Status, e.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package gatewayerr
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Format is the body format used for JSON clients.
+type Format int
+
+const (
+	// FormatJSON renders {"error": {"code", "message", "request_id"}}.
+	FormatJSON Format = iota
+	// FormatProblem renders RFC 7807 application/problem+json.
+	FormatProblem
+)
+
+// ParseFormat maps "json" or "problem" to a Format.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return FormatJSON, nil
+	case "problem", "problem+json":
+		return FormatProblem, nil
+	default:
+		return FormatJSON, fmt.Errorf("unknown error format %q", s)
+	}
+}
+
+const (
+	mediaJSON    = "application/json"
+	mediaProblem = "application/problem+json"
+	mediaHTML    = "text/html"
+)
+
+// PageData is passed to HTML error page templates.
+type PageData struct {
+	Status     int
+	StatusText string
+	Code       Code
+	Message    string
+	RequestID  string
+	Path       string
+}
+
+var defaultPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+<p><small>Code: {{.Code}}{{if .RequestID}} &middot; Request ID: {{.RequestID}}{{end}}</small></p>
+</body>
+</html>
+`))
+
+// LoadPage parses a custom HTML error page template from a file.
+func LoadPage(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error page %s: %v", path, err)
+	}
+	tmpl, err := template.New(path).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse error page %s: %v", path, err)
+	}
+	return tmpl, nil
+}
+
+// Responder writes error responses, negotiating between JSON, problem+json
+// and HTML based on the request's Accept header.
+type Responder struct {
+	format Format
+}
+
+func NewResponder(format Format) *Responder {
+	return &Responder{format: format}
+}
+
+// Write sends e to the client. page optionally overrides the HTML template
+// for this request, e.g. a route's custom error page.
+func (rs *Responder) Write(w http.ResponseWriter, r *http.Request, requestID string, e *Error, page *template.Template) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Vary", "Accept")
+
+	switch rs.negotiate(r.Header.Get("Accept")) {
+	case mediaHTML:
+		rs.writeHTML(w, r, requestID, e, page)
+	case mediaProblem:
+		writeProblem(w, r, requestID, e)
+	default:
+		writeJSON(w, requestID, e)
+	}
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, requestID string, e *Error) {
+	w.Header().Set("Content-Type", mediaJSON)
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(errorBody{Error: errorDetail{
+		Code:      e.Code,
+		Message:   e.Message,
+		RequestID: requestID,
+	}})
+}
+
+// problem is an RFC 7807 problem details object with the gateway's code and
+// request ID as extension members.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, requestID string, e *Error) {
+	w.Header().Set("Content-Type", mediaProblem)
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(problem{
+		Type:      "urn:psygateway:error:" + strings.ToLower(string(e.Code)),
+		Title:     StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: requestID,
+	})
+}
+
+func (rs *Responder) writeHTML(w http.ResponseWriter, r *http.Request, requestID string, e *Error, page *template.Template) {
+	data := PageData{
+		Status:     e.Status,
+		StatusText: StatusText(e.Status),
+		Code:       e.Code,
+		Message:    e.Message,
+		RequestID:  requestID,
+		Path:       r.URL.Path,
+	}
+
+	// Render into a buffer first so a broken custom template can still fall
+	// back to the default page
+	var body strings.Builder
+	if page == nil || page.Execute(&body, data) != nil {
+		body.Reset()
+		defaultPage.Execute(&body, data)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(e.Status)
+	fmt.Fprint(w, body.String())
+}
+
+// negotiate picks the error media type with the highest q-value in the
+// Accept header. JSON wins ties and is used when nothing matches, with the
+// configured format deciding between plain JSON and problem+json.
+func (rs *Responder) negotiate(accept string) string {
+	preferred := mediaJSON
+	if rs.format == FormatProblem {
+		preferred = mediaProblem
+	}
+	if accept == "" {
+		return preferred
+	}
+
+	best, bestQ := preferred, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case mediaProblem:
+			candidate = mediaProblem
+		case mediaJSON, "application/*", "*/*":
+			candidate = preferred
+		case mediaHTML, "application/xhtml+xml", "text/*":
+			candidate = mediaHTML
+		default:
+			continue
+		}
+		if q > bestQ || q == bestQ && candidate == preferred {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,38 @@
+package gatewayerr
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		format Format
+		accept string
+		want   string
+	}{
+		{FormatJSON, "", mediaJSON},
+		{FormatProblem, "", mediaProblem},
+		{FormatJSON, "text/html", mediaHTML},
+		{FormatJSON, "application/json", mediaJSON},
+		{FormatJSON, "application/problem+json", mediaProblem},
+		{FormatJSON, "image/png", mediaJSON},
+		{FormatJSON, "*/*", mediaJSON},
+		{FormatProblem, "*/*", mediaProblem},
+		{FormatJSON, "text/*", mediaHTML},
+
+		// Ties go to JSON regardless of order
+		{FormatJSON, "text/html, application/json", mediaJSON},
+		{FormatJSON, "application/json, text/html", mediaJSON},
+		{FormatProblem, "text/html, */*", mediaProblem},
+		{FormatJSON, "text/html;q=0.5, application/json;q=0.5", mediaJSON},
+
+		{FormatJSON, "text/html, application/json;q=0.9", mediaHTML},
+		{FormatJSON, "application/json;q=0.1, text/html;q=0.8", mediaHTML},
+		{FormatJSON, "text/html;q=0", mediaJSON},
+		{FormatJSON, "text/html;q=bogus, application/json;q=0.5", mediaHTML},
+	}
+	for _, tt := range tests {
+		rs := NewResponder(tt.format)
+		if got := rs.negotiate(tt.accept); got != tt.want {
+			t.Errorf("negotiate(%q) with format %d = %q, want %q", tt.accept, tt.format, got, tt.want)
+		}
+	}
+}
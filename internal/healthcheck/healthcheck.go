@@ -0,0 +1,207 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// Config describes how a single upstream target is probed.
+type Config struct {
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	// Client sends the probes, e.g. the service's pool so https targets see
+	// the same TLS settings as proxied requests; nil = a plain client
+	Client *http.Client
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Second
+	}
+	if c.HealthyThreshold <= 0 {
+		c.HealthyThreshold = 2
+	}
+	if c.UnhealthyThreshold <= 0 {
+		c.UnhealthyThreshold = 3
+	}
+	return c
+}
+
+// TargetStatus is a point-in-time view of a probed target.
+type TargetStatus struct {
+	Target    string    `json:"target"`
+	Path      string    `json:"path"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// maxDrain bounds how much of a probe's response body is read before the
+// connection is given back for reuse; larger bodies close it instead.
+const maxDrain = 64 << 10
+
+type target struct {
+	url       string
+	cfg       Config
+	healthy   bool
+	successes int
+	failures  int
+	lastCheck time.Time
+	lastError string
+}
+
+// Checker actively probes upstream targets over HTTP and tracks whether they
+// are healthy according to consecutive success/failure thresholds.
+type Checker struct {
+	mu      sync.RWMutex
+	client  *http.Client
+	targets map[string]*target
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewChecker() *Checker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Checker{
+		client:  &http.Client{},
+		targets: make(map[string]*target),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Add starts probing a target. Targets start out healthy so traffic is not
+// rejected before the first probes complete. Adding a target twice is a
+// no-op, so the route table must not probe one target on several paths.
+func (c *Checker) Add(targetURL string, cfg Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.targets[targetURL]; ok {
+		return
+	}
+	t := &target{url: targetURL, cfg: cfg.withDefaults(), healthy: true}
+	c.targets[targetURL] = t
+
+	c.wg.Add(1)
+	go c.run(t)
+}
+
+// Healthy reports whether a target is healthy. Targets that are not probed
+// are always considered healthy.
+func (c *Checker) Healthy(targetURL string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	t, ok := c.targets[targetURL]
+	if !ok {
+		return true
+	}
+	return t.healthy
+}
+
+// Status returns the state of every probed target.
+func (c *Checker) Status() []TargetStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]TargetStatus, 0, len(c.targets))
+	for _, t := range c.targets {
+		result = append(result, TargetStatus{
+			Target:    t.url,
+			Path:      t.cfg.Path,
+			Healthy:   t.healthy,
+			LastCheck: t.lastCheck,
+			LastError: t.lastError,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Target < result[j].Target })
+	return result
+}
+
+// Stop ends all probing goroutines.
+func (c *Checker) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *Checker) run(t *target) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	c.probe(t)
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.probe(t)
+		}
+	}
+}
+
+func (c *Checker) probe(t *target) {
+	ctx, cancel := context.WithTimeout(c.ctx, t.cfg.Timeout)
+	defer cancel()
+
+	probeURL := strings.TrimSuffix(t.url, "/") + t.cfg.Path
+	errMsg := ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err == nil {
+		var resp *http.Response
+		client := c.client
+		if t.cfg.Client != nil {
+			client = t.cfg.Client
+		}
+		resp, err = client.Do(req)
+		if err == nil {
+			// Drain a bounded amount so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+				errMsg = resp.Status
+			}
+		}
+	}
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t.lastCheck = time.Now()
+	t.lastError = errMsg
+	if errMsg == "" {
+		t.successes++
+		t.failures = 0
+		if !t.healthy && t.successes >= t.cfg.HealthyThreshold {
+			t.healthy = true
+			logger.Info("Upstream target became healthy", "target", t.url)
+		}
+		return
+	}
+
+	t.failures++
+	t.successes = 0
+	if t.healthy && t.failures >= t.cfg.UnhealthyThreshold {
+		t.healthy = false
+		logger.Warn("Upstream target became unhealthy", "target", t.url, "error", errMsg)
+	}
+}
@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config selects where logs go, the minimum level and sampling. It is
+// usually read from the environment with ConfigFromEnv.
+type Config struct {
+	// Outputs are output specs, see openOutput. Empty means stdout.
+	Outputs []string
+	// Level is "debug", "info", "warn" or "error"; empty keeps the current level.
+	Level string
+	// Sampling holds rules in ParseSampling syntax.
+	Sampling         string
+	SamplingInterval time.Duration
+	// RedactFields and RedactPatterns (ParseRedactPatterns syntax) extend the
+	// default redaction rules; DisableRedaction turns redaction off.
+	RedactFields     []string
+	RedactPatterns   string
+	DisableRedaction bool
+}
+
+// ConfigFromEnv reads LOG_OUTPUTS (comma separated), LOG_LEVEL,
+// LOG_SAMPLING, LOG_SAMPLING_INTERVAL, LOG_REDACT_FIELDS (comma separated),
+// LOG_REDACT_PATTERNS and LOG_REDACT ("off" disables redaction).
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Level:            os.Getenv("LOG_LEVEL"),
+		Sampling:         os.Getenv("LOG_SAMPLING"),
+		Outputs:          splitList(os.Getenv("LOG_OUTPUTS")),
+		RedactFields:     splitList(os.Getenv("LOG_REDACT_FIELDS")),
+		RedactPatterns:   os.Getenv("LOG_REDACT_PATTERNS"),
+		DisableRedaction: os.Getenv("LOG_REDACT") == "off",
+	}
+	if interval, err := time.ParseDuration(os.Getenv("LOG_SAMPLING_INTERVAL")); err == nil {
+		cfg.SamplingInterval = interval
+	}
+	return cfg
+}
+
+// Configure applies cfg to every logger of this package. Previously opened
+// outputs other than stdout/stderr are closed.
+func Configure(cfg Config) error {
+	if cfg.Level != "" {
+		lvl, err := ParseLevel(cfg.Level)
+		if err != nil {
+			return err
+		}
+		SetLevel(lvl)
+	}
+
+	rules, err := ParseSampling(cfg.Sampling)
+	if err != nil {
+		return err
+	}
+	settings.sampler.configure(rules, cfg.SamplingInterval)
+
+	if cfg.DisableRedaction {
+		settings.redactor.Store(nil)
+	} else {
+		patterns, err := ParseRedactPatterns(cfg.RedactPatterns)
+		if err != nil {
+			return err
+		}
+		fields := append(append([]string{}, DefaultRedactFields...), cfg.RedactFields...)
+		patterns = append(append([]RedactPattern{}, DefaultRedactPatterns...), patterns...)
+		settings.redactor.Store(NewRedactor(fields, patterns))
+	}
+
+	specs := cfg.Outputs
+	if len(specs) == 0 {
+		specs = []string{"stdout"}
+	}
+	outputs := make([]output, 0, len(specs))
+	for _, spec := range specs {
+		out, err := openOutput(spec)
+		if err != nil {
+			closeOutputs(outputs)
+			return err
+		}
+		outputs = append(outputs, out)
+	}
+
+	settings.mu.Lock()
+	previous := settings.outputs
+	settings.outputs = outputs
+	settings.mu.Unlock()
+
+	closeOutputs(previous)
+	return nil
+}
+
+// Reopen reopens file outputs, for use after external log rotation.
+func Reopen() error {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+
+	for _, out := range settings.outputs {
+		if r, ok := out.w.(reopener); ok {
+			if err := r.Reopen(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func closeOutputs(outputs []output) {
+	for _, out := range outputs {
+		if out.console {
+			continue
+		}
+		if c, ok := out.w.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// CurrentRedactor returns the redactor applied to log output, or nil when
+// LOG_REDACT=off. Writers outside this package, such as the access log, use
+// it to apply the same rules.
+func CurrentRedactor() *Redactor {
+	return settings.redactor.Load()
+}
+
+// SetLevel changes the minimum level at runtime.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// GetLevel returns the current minimum level.
+func GetLevel() slog.Level {
+	return level.Level()
+}
+
+// LevelName returns the upper case name used in log output for l.
+func LevelName(l slog.Level) string {
+	return levelName(l)
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
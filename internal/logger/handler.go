@@ -0,0 +1,264 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharedSettings is the state every handler of this package writes through.
+type sharedSettings struct {
+	mu       sync.Mutex
+	outputs  []output
+	pretty   atomic.Bool
+	sampler  sampler
+	redactor atomic.Pointer[Redactor] // nil disables redaction
+}
+
+func newSharedSettings(out io.Writer) *sharedSettings {
+	s := &sharedSettings{outputs: []output{{w: out, console: true}}}
+	s.pretty.Store(true)
+	s.redactor.Store(NewRedactor(DefaultRedactFields, DefaultRedactPatterns))
+	return s
+}
+
+// HandlerOptions configures a Handler. Zero values use the package-level
+// level (see SetVerbose) and output settings (see SetPrettyLogs).
+type HandlerOptions struct {
+	Level slog.Leveler
+}
+
+// Handler is an slog.Handler producing either colored human readable lines
+// or one JSON object per line, depending on SetPrettyLogs.
+type Handler struct {
+	settings *sharedSettings
+	level    slog.Leveler
+	attrs    []slog.Attr // already qualified with their group prefix
+	prefix   string      // dotted group path for attrs added later
+}
+
+func NewHandler(opts HandlerOptions) *Handler {
+	h := &Handler{settings: settings, level: opts.Level}
+	if h.level == nil {
+		h.level = level
+	}
+	return h
+}
+
+func (h *Handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), qualify(h.prefix, attrs)...)
+	return &clone
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	if !h.settings.sampler.allow(r.Level, r.Message) {
+		return nil
+	}
+
+	fields := append([]slog.Attr{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, qualify(h.prefix, []slog.Attr{a})...)
+		return true
+	})
+	if redactor := h.settings.redactor.Load(); redactor != nil {
+		fields = redactor.Attrs(fields)
+		r.Message = redactor.String(r.Message)
+	}
+
+	// Each format is rendered at most once, on first use by an output
+	var pretty, plain []byte
+	render := func(console bool) []byte {
+		if console && h.settings.pretty.Load() {
+			if pretty == nil {
+				var buf bytes.Buffer
+				formatPretty(&buf, r, fields)
+				buf.WriteByte('\n')
+				pretty = buf.Bytes()
+			}
+			return pretty
+		}
+		if plain == nil {
+			var buf bytes.Buffer
+			formatJSON(&buf, r, fields)
+			buf.WriteByte('\n')
+			plain = buf.Bytes()
+		}
+		return plain
+	}
+
+	h.settings.mu.Lock()
+	defer h.settings.mu.Unlock()
+
+	var firstErr error
+	for _, out := range h.settings.outputs {
+		var err error
+		if lw, ok := out.w.(levelWriter); ok {
+			_, err = lw.WriteLevel(r.Level, render(out.console))
+		} else {
+			_, err = out.w.Write(render(out.console))
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// qualify resolves attrs, prefixes their keys and flattens groups into
+// dotted keys.
+func qualify(prefix string, attrs []slog.Attr) []slog.Attr {
+	var result []slog.Attr
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() == slog.KindGroup {
+			groupPrefix := prefix
+			if a.Key != "" {
+				groupPrefix += a.Key + "."
+			}
+			result = append(result, qualify(groupPrefix, a.Value.Group())...)
+			continue
+		}
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		a.Key = prefix + a.Key
+		result = append(result, a)
+	}
+	return result
+}
+
+func levelName(l slog.Level) string {
+	switch {
+	case l >= LevelFatal:
+		return "FATAL"
+	case l >= slog.LevelError:
+		return "ERROR"
+	case l >= slog.LevelWarn:
+		return "WARN"
+	case l >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+func getLevelColor(level string) string {
+	switch level {
+	case "DEBUG":
+		return ColorGray
+	case "INFO":
+		return ColorBlue
+	case "WARN":
+		return ColorYellow
+	case "ERROR":
+		return ColorRed
+	case "FATAL":
+		return ColorRed + ColorBold
+	default:
+		return ColorReset
+	}
+}
+
+func formatPretty(buf *bytes.Buffer, r slog.Record, fields []slog.Attr) {
+	level := levelName(r.Level)
+	levelColor := getLevelColor(level)
+
+	// Timestamp in dim gray
+	fmt.Fprintf(buf, "%s%s%s ", ColorDim, r.Time.Format("15:04:05"), ColorReset)
+
+	// Colored level with fixed width
+	fmt.Fprintf(buf, "%s%-5s%s ", levelColor, level, ColorReset)
+
+	// Message
+	buf.WriteString(r.Message)
+
+	// Fields as dim key=value pairs
+	for _, field := range fields {
+		fmt.Fprintf(buf, " %s%s=%s%s", ColorDim, field.Key, prettyValue(field.Value), ColorReset)
+	}
+}
+
+func prettyValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		s := v.String()
+		if s == "" || strings.ContainsAny(s, " \t\"=") {
+			return fmt.Sprintf("%q", s)
+		}
+		return s
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339)
+	case slog.KindAny:
+		any := v.Any()
+		if err, ok := any.(error); ok {
+			return fmt.Sprintf("%q", err.Error())
+		}
+		if b, err := json.Marshal(any); err == nil {
+			return string(b)
+		}
+		return fmt.Sprintf("%+v", any)
+	default:
+		return v.String()
+	}
+}
+
+func formatJSON(buf *bytes.Buffer, r slog.Record, fields []slog.Attr) {
+	buf.WriteString(`{"timestamp":`)
+	writeJSONValue(buf, r.Time.Format(time.RFC3339))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, levelName(r.Level))
+	buf.WriteString(`,"message":`)
+	writeJSONValue(buf, r.Message)
+	for _, field := range fields {
+		buf.WriteByte(',')
+		writeJSONValue(buf, field.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, jsonValue(field.Value))
+	}
+	buf.WriteByte('}')
+}
+
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+		return v.Any()
+	default:
+		return v.Any()
+	}
+}
+
+func writeJSONValue(buf *bytes.Buffer, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(b)
+}
@@ -1,11 +1,9 @@
 package logger
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
-	"strings"
-	"time"
 )
 
 // ANSI color codes
@@ -22,116 +20,133 @@ const (
 	ColorDim    = "\033[2m"
 )
 
-type LogEntry struct {
-	ID        int    `json:"id"`
-	Timestamp string `json:"timestamp"`
-	Level     string `json:"level"`
-	Message   string `json:"message"`
-	Data      any    `json:"details,omitempty"`
-}
+// LevelFatal sits above slog.LevelError; Fatal logs at this level and exits.
+const LevelFatal = slog.Level(12)
 
-var verbose bool
-var prettyLogs = true
+// level and settings are shared by every handler created by this package so
+// that SetVerbose and SetPrettyLogs apply to loggers created earlier.
+var (
+	level    = new(slog.LevelVar)
+	settings = newSharedSettings(os.Stdout)
+)
 
-func SetVerbose(v bool) {
-	verbose = v
+var defaultLogger = New(NewHandler(HandlerOptions{}))
+
+func init() {
+	// Route the standard library's slog and log packages through our handler
+	slog.SetDefault(defaultLogger.slog)
 }
 
-func SetPrettyLogs(pretty bool) {
-	prettyLogs = pretty
-}
-
-func getLevelColor(level string) string {
-	switch level {
-	case "DEBUG":
-		return ColorGray
-	case "INFO":
-		return ColorBlue
-	case "WARN":
-		return ColorYellow
-	case "ERROR":
-		return ColorRed
-	case "FATAL":
-		return ColorRed + ColorBold
-	default:
-		return ColorReset
+func SetVerbose(v bool) {
+	if v {
+		level.Set(slog.LevelDebug)
+	} else {
+		level.Set(slog.LevelInfo)
 	}
 }
 
-func formatPrettyLog(level, message string, data any) string {
-	timestamp := time.Now().Format("15:04:05")
-	levelColor := getLevelColor(level)
-
-	// Format level with fixed width
-	levelFormatted := fmt.Sprintf("%-5s", level)
+func SetPrettyLogs(pretty bool) {
+	settings.pretty.Store(pretty)
+}
 
-	var output strings.Builder
+// Logger writes key/value structured entries. Fields bound with With are
+// added to every entry written by the returned child logger.
+type Logger struct {
+	slog *slog.Logger
+}
 
-	// Timestamp in dim gray
-	output.WriteString(fmt.Sprintf("%s%s%s ", ColorDim, timestamp, ColorReset))
+// New wraps any slog.Handler in a Logger.
+func New(h slog.Handler) *Logger {
+	return &Logger{slog: slog.New(h)}
+}
 
-	// Colored level
-	output.WriteString(fmt.Sprintf("%s%s%s ", levelColor, levelFormatted, ColorReset))
+// Default returns the package-level logger.
+func Default() *Logger {
+	return defaultLogger
+}
 
-	// Message
-	output.WriteString(message)
+// Slog exposes the underlying *slog.Logger for code using the standard API.
+func (l *Logger) Slog() *slog.Logger {
+	return l.slog
+}
 
-	// Data if present
-	if data != nil {
-		dataStr := ""
-		if dataBytes, err := json.Marshal(data); err == nil {
-			dataStr = string(dataBytes)
-		} else {
-			dataStr = fmt.Sprintf("%+v", data)
-		}
-		output.WriteString(fmt.Sprintf(" %s%s%s", ColorDim, dataStr, ColorReset))
-	}
+// With returns a child logger with the given key/value fields bound.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{slog: l.slog.With(normalize(args)...)}
+}
 
-	return output.String()
+func (l *Logger) Debug(message string, args ...any) {
+	l.log(slog.LevelDebug, message, args)
+}
+func (l *Logger) Info(message string, args ...any) {
+	l.log(slog.LevelInfo, message, args)
+}
+func (l *Logger) Warn(message string, args ...any) {
+	l.log(slog.LevelWarn, message, args)
+}
+func (l *Logger) Error(message string, args ...any) {
+	l.log(slog.LevelError, message, args)
+}
+func (l *Logger) Fatal(message string, args ...any) {
+	l.log(LevelFatal, message, args)
+	os.Exit(1)
 }
 
-func log(level, message string, data interface{}) {
-	if level == "DEBUG" && !verbose {
-		return
-	}
+func (l *Logger) log(lvl slog.Level, message string, args []any) {
+	l.slog.Log(context.Background(), lvl, message, normalize(args)...)
+}
 
-	if prettyLogs {
-		// Pretty formatted output
-		prettyOutput := formatPrettyLog(level, message, data)
-		fmt.Fprintln(os.Stdout, prettyOutput)
-	} else {
-		// JSON formatted output
-		entry := LogEntry{
-			Level:     level,
-			Timestamp: time.Now().Format(time.RFC3339),
-			Message:   message,
-			Data:      data,
-		}
-		b, _ := json.Marshal(entry)
-		fmt.Fprintf(os.Stdout, "%s\n", b)
-	}
+// With returns a child of the package-level logger with fields bound.
+func With(args ...any) *Logger {
+	return defaultLogger.With(args...)
 }
 
-func Debug(message string, data ...any) {
-	log("DEBUG", message, FirstOrNil(data))
+func Debug(message string, args ...any) {
+	defaultLogger.log(slog.LevelDebug, message, args)
 }
-func Info(message string, data ...any) {
-	log("INFO", message, FirstOrNil(data))
+func Info(message string, args ...any) {
+	defaultLogger.log(slog.LevelInfo, message, args)
 }
-func Warn(message string, data ...any) {
-	log("WARN", message, FirstOrNil(data))
+func Warn(message string, args ...any) {
+	defaultLogger.log(slog.LevelWarn, message, args)
 }
-func Error(message string, data ...any) {
-	log("ERROR", message, FirstOrNil(data))
+func Error(message string, args ...any) {
+	defaultLogger.log(slog.LevelError, message, args)
 }
-func Fatal(message string, data ...any) {
-	log("FATAL", message, FirstOrNil(data))
+func Fatal(message string, args ...any) {
+	defaultLogger.log(LevelFatal, message, args)
 	os.Exit(1)
 }
 
-func FirstOrNil(data []any) any {
-	if len(data) == 0 {
-		return nil
+// normalize lets an error be passed without a key, as in
+// logger.Error("Failed to ping database", err), by keying it "error".
+func normalize(args []any) []any {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i].(type) {
+		case error:
+			normalized := make([]any, 0, len(args)+1)
+			normalized = append(normalized, args[:i]...)
+			normalized = append(normalized, "error", arg)
+			return append(normalized, normalize(args[i+1:])...)
+		case string:
+			i++ // skip the value
+		}
+	}
+	return args
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the package-level logger
+// when there is none.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
 	}
-	return data[0]
+	return defaultLogger
 }
@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// output is a destination for log entries. Console outputs receive the
+// pretty format when it is enabled; every other output always receives JSON
+// so files and log collectors stay machine readable.
+type output struct {
+	w       io.Writer
+	console bool
+}
+
+// levelWriter is implemented by outputs that need the entry's level, such as
+// syslog which encodes it in the message priority.
+type levelWriter interface {
+	WriteLevel(level slog.Level, p []byte) (int, error)
+}
+
+// reopener is implemented by outputs backed by files that can be reopened,
+// e.g. after an external logrotate moved them away.
+type reopener interface {
+	Reopen() error
+}
+
+// openOutput opens an output from its spec:
+//
+//	stdout | stderr
+//	file:/var/log/gateway.log?max_size_mb=100&rotate_every=24h&max_backups=7
+//	udp://syslog-host:514
+func openOutput(spec string) (output, error) {
+	switch spec {
+	case "stdout":
+		return output{w: os.Stdout, console: true}, nil
+	case "stderr":
+		return output{w: os.Stderr, console: true}, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return output{}, fmt.Errorf("invalid log output %q: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		query := u.Query()
+		maxSizeMB, _ := strconv.Atoi(query.Get("max_size_mb"))
+		maxBackups, _ := strconv.Atoi(query.Get("max_backups"))
+		rotateEvery, _ := time.ParseDuration(query.Get("rotate_every"))
+		f, err := NewRotatingFile(path, int64(maxSizeMB)<<20, rotateEvery, maxBackups)
+		if err != nil {
+			return output{}, err
+		}
+		return output{w: f}, nil
+	case "udp":
+		w, err := NewSyslogWriter(u.Host)
+		if err != nil {
+			return output{}, err
+		}
+		return output{w: w}, nil
+	default:
+		return output{}, fmt.Errorf("unsupported log output %q", spec)
+	}
+}
+
+// OpenWriter opens an output spec (see openOutput) as a plain writer, for
+// streams such as access logs that are written separately from application
+// logs.
+func OpenWriter(spec string) (io.Writer, error) {
+	out, err := openOutput(spec)
+	if err != nil {
+		return nil, err
+	}
+	return out.w, nil
+}
+
+// SyslogWriter sends each entry as an RFC 5424 syslog message over UDP.
+type SyslogWriter struct {
+	conn     net.Conn
+	hostname string
+	app      string
+}
+
+func NewSyslogWriter(addr string) (*SyslogWriter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial syslog %s: %v", addr, err)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogWriter{conn: conn, hostname: hostname, app: filepath.Base(os.Args[0])}, nil
+}
+
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(slog.LevelInfo, p)
+}
+
+// WriteLevel frames p with facility local0 and the severity of level.
+func (s *SyslogWriter) WriteLevel(level slog.Level, p []byte) (int, error) {
+	const facilityLocal0 = 16
+	priority := facilityLocal0*8 + syslogSeverity(level)
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, time.Now().Format(time.RFC3339Nano),
+		s.hostname, s.app, os.Getpid(), strings.TrimRight(string(p), "\n"))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *SyslogWriter) Close() error {
+	return s.conn.Close()
+}
+
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= LevelFatal:
+		return 2 // critical
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,221 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// DefaultRedactFields are field and header names whose values are always
+// masked. Matching ignores case, treats '_' and '-' alike and only looks at
+// the last segment of dotted keys, so "request.headers.Authorization" matches
+// "authorization".
+var DefaultRedactFields = []string{
+	"authorization", "proxy-authorization", "cookie", "set-cookie",
+	"x-api-key", "api-key", "apikey", "password", "passwd", "secret",
+	"client-secret", "token", "access-token", "refresh-token",
+}
+
+// RedactPattern masks every match of Regexp in string values. Replacement
+// may reference capture groups ($1). Validate, when set, is called on each
+// match and the match is kept when it returns false.
+type RedactPattern struct {
+	Name        string
+	Regexp      *regexp.Regexp
+	Replacement string
+	Validate    func(match string) bool
+}
+
+// DefaultRedactPatterns mask credentials and personal data that commonly end
+// up in free text: JWTs, Authorization schemes, URL passwords, emails and
+// card numbers.
+var DefaultRedactPatterns = []RedactPattern{
+	{Name: "url_credentials", Regexp: regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), Replacement: "${1}" + redacted + "@"},
+	{Name: "jwt", Regexp: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Replacement: "[REDACTED_JWT]"},
+	{Name: "auth_scheme", Regexp: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), Replacement: "$1 " + redacted},
+	{Name: "email", Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), Replacement: "[REDACTED_EMAIL]"},
+	{Name: "card", Regexp: regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,7}\b`), Replacement: "[REDACTED_CARD]", Validate: luhnValid},
+}
+
+// Redactor masks sensitive values in log fields and messages before they
+// are formatted, so every output receives the same redacted entry.
+type Redactor struct {
+	fields   map[string]bool
+	patterns []RedactPattern
+}
+
+// NewRedactor creates a redactor masking the given field names and patterns.
+func NewRedactor(fields []string, patterns []RedactPattern) *Redactor {
+	r := &Redactor{fields: make(map[string]bool), patterns: patterns}
+	for _, f := range fields {
+		r.fields[normalizeKey(f)] = true
+	}
+	return r
+}
+
+// ParseRedactPatterns compiles user supplied regular expressions separated by
+// ";". Matches are replaced with [REDACTED].
+func ParseRedactPatterns(spec string) ([]RedactPattern, error) {
+	var patterns []RedactPattern
+	for _, expr := range strings.Split(spec, ";") {
+		if expr = strings.TrimSpace(expr); expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", expr, err)
+		}
+		patterns = append(patterns, RedactPattern{Name: expr, Regexp: re, Replacement: redacted})
+	}
+	return patterns, nil
+}
+
+// String masks pattern matches in s.
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		if p.Validate == nil {
+			s = p.Regexp.ReplaceAllString(s, p.Replacement)
+			continue
+		}
+		s = p.Regexp.ReplaceAllStringFunc(s, func(match string) string {
+			if !p.Validate(match) {
+				return match
+			}
+			return p.Regexp.ReplaceAllString(match, p.Replacement)
+		})
+	}
+	return s
+}
+
+// Query masks a raw query string: parameters named like a redacted field,
+// e.g. api_key or access_token, lose their value and the other values are
+// matched against the patterns, decoded first if they are escaped.
+func (r *Redactor) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			params[i] = r.String(param)
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && r.fields[normalizeKey(name)] {
+			params[i] = key + "=" + redacted
+			continue
+		}
+		if decoded, err := url.QueryUnescape(value); err == nil && decoded != value {
+			if masked := r.String(decoded); masked != decoded {
+				params[i] = key + "=" + masked
+				continue
+			}
+		}
+		params[i] = key + "=" + r.String(value)
+	}
+	return strings.Join(params, "&")
+}
+
+// URL masks s like String, and its query string like Query.
+func (r *Redactor) URL(s string) string {
+	base, query, ok := strings.Cut(s, "?")
+	if !ok {
+		return r.String(s)
+	}
+	return r.String(base) + "?" + r.Query(query)
+}
+
+// Attrs returns attrs with sensitive values masked. attrs are already
+// flattened by qualify.
+func (r *Redactor) Attrs(attrs []slog.Attr) []slog.Attr {
+	result := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		result[i] = slog.Attr{Key: a.Key, Value: r.value(a.Key, a.Value)}
+	}
+	return result
+}
+
+func (r *Redactor) value(key string, v slog.Value) slog.Value {
+	if r.fields[normalizeKey(key)] {
+		return slog.StringValue(redacted)
+	}
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(r.String(v.String()))
+	case slog.KindAny:
+		value := v.Any()
+		if err, ok := value.(error); ok {
+			return slog.StringValue(r.String(err.Error()))
+		}
+		// Structs, maps and headers are walked in their JSON form so that
+		// nested fields are matched by name like top-level ones
+		b, err := json.Marshal(value)
+		if err != nil {
+			return slog.StringValue(r.String(fmt.Sprintf("%+v", value)))
+		}
+		var generic any
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return slog.StringValue(r.String(string(b)))
+		}
+		return slog.AnyValue(r.walk(generic))
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) walk(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if r.fields[normalizeKey(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = r.walk(child)
+			}
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = r.walk(child)
+		}
+		return v
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+func normalizeKey(key string) string {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum, which
+// keeps ordinary long numbers from being masked as card numbers.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an io.Writer appending to a file that is rotated once it
+// exceeds maxSize bytes or has been open for rotateEvery. Rotated files are
+// renamed with a timestamp suffix and only the newest maxBackups are kept.
+// Zero values disable the respective limit.
+type RotatingFile struct {
+	path        string
+	maxSize     int64
+	rotateEvery time.Duration
+	maxBackups  int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func NewRotatingFile(path string, maxSize int64, rotateEvery time.Duration, maxBackups int) (*RotatingFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("log file path is empty")
+	}
+	f := &RotatingFile{path: path, maxSize: maxSize, rotateEvery: rotateEvery, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.shouldRotate(int64(len(p))) {
+		// A failed rotation keeps writing to the current file rather than
+		// dropping log lines; it is retried once the limit is reached again
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+			f.size = 0
+			f.openedAt = time.Now()
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the file at its path without rotating it.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+func (f *RotatingFile) shouldRotate(incoming int64) bool {
+	if f.maxSize > 0 && f.size > 0 && f.size+incoming > f.maxSize {
+		return true
+	}
+	return f.rotateEvery > 0 && time.Since(f.openedAt) >= f.rotateEvery
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %v", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// rotate renames the file while it is still open and only then switches to
+// a new one, so the current file stays usable if either step fails.
+func (f *RotatingFile) rotate() error {
+	backup := f.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(f.path, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	old.Close()
+	f.pruneBackups()
+	return nil
+}
+
+func (f *RotatingFile) pruneBackups() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	// Timestamp suffixes sort chronologically
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		if !strings.HasPrefix(backups[0], f.path+".") {
+			break
+		}
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
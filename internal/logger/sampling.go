@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SamplingRule lets through the first First occurrences of a message within
+// each interval and then every Thereafter-th one (0 drops the rest).
+type SamplingRule struct {
+	First      int
+	Thereafter int
+}
+
+// sampler rate limits repetitive messages per level. Messages are counted by
+// level and message text, so entries differing only in fields count as
+// repeats.
+type sampler struct {
+	mu          sync.Mutex
+	rules       map[string]SamplingRule
+	interval    time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func (s *sampler) configure(rules map[string]SamplingRule, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s.rules = rules
+	s.interval = interval
+	s.counts = make(map[string]int)
+	s.windowStart = time.Now()
+}
+
+func (s *sampler) allow(level slog.Level, message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := levelName(level)
+	rule, ok := s.rules[name]
+	if !ok {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(s.windowStart) >= s.interval {
+		s.counts = make(map[string]int)
+		s.windowStart = now
+	}
+
+	key := name + "|" + message
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= rule.First {
+		return true
+	}
+	return rule.Thereafter > 0 && (n-rule.First)%rule.Thereafter == 0
+}
+
+// ParseSampling parses rules such as "debug=5/100,info=100/10", meaning for
+// debug the first 5 repeats per interval and then every 100th.
+func ParseSampling(spec string) (map[string]SamplingRule, error) {
+	rules := make(map[string]SamplingRule)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sampling rule %q", part)
+		}
+		lvl, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		firstStr, thereafterStr, _ := strings.Cut(value, "/")
+		first, err := strconv.Atoi(firstStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling rule %q", part)
+		}
+		thereafter := 0
+		if thereafterStr != "" {
+			if thereafter, err = strconv.Atoi(thereafterStr); err != nil {
+				return nil, fmt.Errorf("invalid sampling rule %q", part)
+			}
+		}
+		rules[levelName(lvl)] = SamplingRule{First: first, Thereafter: thereafter}
+	}
+	return rules, nil
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests handled.", "route", "status_class")
+	inFlight := r.NewGaugeVec("in_flight", "Requests in progress.\nPer route.")
+	latency := r.NewHistogramVec("latency_seconds", `Latency with a \ in help.`, []float64{1, 0.1}, "route")
+	r.NewGaugeFunc("healthy", "Health of targets.", []string{"target"}, func(set func(float64, ...string)) {
+		set(0, "http://b")
+		set(1, "http://a")
+	})
+
+	requests.Inc("/users", "2xx")
+	requests.Add(2, "/users", "2xx")
+	requests.Inc(`/say"hi"`, "5xx")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.Observe(0.05, "/users")
+	latency.Observe(0.5, "/users")
+	latency.Observe(3, "/users")
+
+	want := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{route="/say\"hi\"",status_class="5xx"} 1
+requests_total{route="/users",status_class="2xx"} 3
+# HELP in_flight Requests in progress.\nPer route.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency with a \\ in help.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/users",le="0.1"} 1
+latency_seconds_bucket{route="/users",le="1"} 2
+latency_seconds_bucket{route="/users",le="+Inf"} 3
+latency_seconds_sum{route="/users"} 3.55
+latency_seconds_count{route="/users"} 3
+# HELP healthy Health of targets.
+# TYPE healthy gauge
+healthy{target="http://a"} 1
+healthy{target="http://b"} 0
+`
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", got, want)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo returned %d bytes, wrote %d", n, b.Len())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("up", "Up.").Set(1)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "\nup 1\n") {
+		t.Errorf("body = %q, want the up sample", rec.Body.String())
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with a missing label value did not panic")
+		}
+	}()
+	NewRegistry().NewCounterVec("c", "C.", "a", "b").Inc("x")
+}
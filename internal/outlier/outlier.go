@@ -0,0 +1,247 @@
+package outlier
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// Config controls when an upstream instance is considered an outlier and for
+// how long it is ejected from load balancing.
+type Config struct {
+	// ConsecutiveFailures ejects an instance after this many failures in a row.
+	ConsecutiveFailures int
+	// ErrorRateThreshold ejects an instance whose failure ratio within Window
+	// reaches this value (0-1), once MinRequests have been observed.
+	ErrorRateThreshold float64
+	MinRequests        int
+	Window             time.Duration
+	// LatencyThreshold counts responses slower than this as failures. Zero
+	// disables latency based ejection.
+	LatencyThreshold time.Duration
+	// BaseEjectionTime is doubled on every repeated ejection up to
+	// MaxEjectionTime.
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// MaxEjectionPercent caps the share of a service's instances that can be
+	// ejected at the same time.
+	MaxEjectionPercent int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ConsecutiveFailures: 5,
+		ErrorRateThreshold:  0.5,
+		MinRequests:         10,
+		Window:              30 * time.Second,
+		BaseEjectionTime:    30 * time.Second,
+		MaxEjectionTime:     5 * time.Minute,
+		MaxEjectionPercent:  50,
+	}
+}
+
+// InstanceStatus is a point-in-time view of an instance for status output.
+type InstanceStatus struct {
+	Instance     string     `json:"instance"`
+	Ejected      bool       `json:"ejected"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	Ejections    int        `json:"ejections"`
+	Requests     int        `json:"requests"`
+	Failures     int        `json:"failures"`
+	ErrorRate    float64    `json:"error_rate"`
+	AvgLatencyMs float64    `json:"avg_latency_ms"`
+}
+
+type instanceStats struct {
+	windowStart  time.Time
+	requests     int
+	failures     int
+	consecutive  int
+	avgLatency   time.Duration
+	ejections    int
+	ejectedUntil time.Time
+	decayedAt    time.Time
+}
+
+// Detector tracks per-instance results reported by the proxy path and
+// ejects instances that behave as outliers.
+type Detector struct {
+	mu       sync.Mutex
+	cfg      Config
+	services map[string]map[string]*instanceStats
+}
+
+func NewDetector(cfg Config) *Detector {
+	return &Detector{
+		cfg:      cfg,
+		services: make(map[string]map[string]*instanceStats),
+	}
+}
+
+// Record reports the outcome of one upstream call. A transport error or a
+// 5xx status counts as a failure, as does exceeding LatencyThreshold.
+func (d *Detector) Record(service, instance string, status int, err error, latency time.Duration) {
+	failed := err != nil || status >= 500
+	if d.cfg.LatencyThreshold > 0 && latency > d.cfg.LatencyThreshold {
+		failed = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	stats := d.stats(service, instance)
+	if now.Sub(stats.windowStart) > d.cfg.Window {
+		stats.windowStart = now
+		stats.requests = 0
+		stats.failures = 0
+	}
+
+	stats.requests++
+	if stats.avgLatency == 0 {
+		stats.avgLatency = latency
+	} else {
+		// Exponentially weighted moving average, alpha = 0.2
+		stats.avgLatency = (stats.avgLatency*4 + latency) / 5
+	}
+
+	if !failed {
+		stats.consecutive = 0
+		return
+	}
+	stats.failures++
+	stats.consecutive++
+
+	if stats.ejectedUntil.After(now) {
+		return
+	}
+	d.decay(stats, now)
+
+	tripped := d.cfg.ConsecutiveFailures > 0 && stats.consecutive >= d.cfg.ConsecutiveFailures
+	if !tripped && d.cfg.ErrorRateThreshold > 0 && stats.requests >= d.cfg.MinRequests {
+		tripped = float64(stats.failures)/float64(stats.requests) >= d.cfg.ErrorRateThreshold
+	}
+	if tripped {
+		d.eject(service, instance, stats, now)
+	}
+}
+
+func (d *Detector) eject(service, instance string, stats *instanceStats, now time.Time) {
+	instances := d.services[service]
+	ejected := 0
+	for _, s := range instances {
+		if s.ejectedUntil.After(now) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > len(instances)*d.cfg.MaxEjectionPercent {
+		logger.Warn("Outlier ejection skipped, max ejection percent reached", "service", service, "instance", instance)
+		return
+	}
+
+	duration := d.cfg.BaseEjectionTime << stats.ejections
+	if duration <= 0 || duration > d.cfg.MaxEjectionTime {
+		duration = d.cfg.MaxEjectionTime
+	}
+	stats.ejections++
+	stats.ejectedUntil = now.Add(duration)
+	stats.consecutive = 0
+	stats.windowStart = now
+	stats.requests = 0
+	stats.failures = 0
+
+	logger.Warn("Ejected outlier instance", "service", service, "instance", instance, "duration", duration.String())
+}
+
+// decay forgets one past ejection for every BaseEjectionTime an instance
+// stays in rotation, so a recovered instance is ejected for the base time
+// again rather than for the maximum.
+func (d *Detector) decay(stats *instanceStats, now time.Time) {
+	if stats.ejections == 0 || stats.ejectedUntil.After(now) || d.cfg.BaseEjectionTime <= 0 {
+		return
+	}
+	since := stats.ejectedUntil
+	if stats.decayedAt.After(since) {
+		since = stats.decayedAt
+	}
+	periods := int(now.Sub(since) / d.cfg.BaseEjectionTime)
+	if periods == 0 {
+		return
+	}
+	stats.ejections = max(stats.ejections-periods, 0)
+	stats.decayedAt = since.Add(time.Duration(periods) * d.cfg.BaseEjectionTime)
+}
+
+// Filter returns the instances that are not currently ejected. instances is
+// the service's full current instance set: instances missing from it are
+// forgotten, so ones that left discovery neither keep their stats forever
+// nor count towards MaxEjectionPercent.
+func (d *Detector) Filter(service string, instances []string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	current := make(map[string]bool, len(instances))
+	available := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		current[instance] = true
+		stats := d.stats(service, instance)
+		d.decay(stats, now)
+		if stats.ejectedUntil.After(now) {
+			continue
+		}
+		available = append(available, instance)
+	}
+	for instance := range d.services[service] {
+		if !current[instance] {
+			delete(d.services[service], instance)
+		}
+	}
+	return available
+}
+
+// Status returns the current view of every known instance of a service.
+func (d *Detector) Status(service string) []InstanceStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	var result []InstanceStatus
+	for instance, stats := range d.services[service] {
+		d.decay(stats, now)
+		status := InstanceStatus{
+			Instance:     instance,
+			Ejections:    stats.ejections,
+			Requests:     stats.requests,
+			Failures:     stats.failures,
+			AvgLatencyMs: float64(stats.avgLatency) / float64(time.Millisecond),
+		}
+		if stats.requests > 0 {
+			status.ErrorRate = float64(stats.failures) / float64(stats.requests)
+		}
+		if stats.ejectedUntil.After(now) {
+			status.Ejected = true
+			until := stats.ejectedUntil
+			status.EjectedUntil = &until
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Instance < result[j].Instance })
+	return result
+}
+
+func (d *Detector) stats(service, instance string) *instanceStats {
+	instances, ok := d.services[service]
+	if !ok {
+		instances = make(map[string]*instanceStats)
+		d.services[service] = instances
+	}
+	stats, ok := instances[instance]
+	if !ok {
+		stats = &instanceStats{windowStart: time.Now()}
+		instances[instance] = stats
+	}
+	return stats
+}
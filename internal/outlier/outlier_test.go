@@ -0,0 +1,144 @@
+package outlier
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		ConsecutiveFailures: 3,
+		BaseEjectionTime:    100 * time.Millisecond,
+		MaxEjectionTime:     time.Second,
+		MaxEjectionPercent:  100,
+		Window:              time.Minute,
+	}
+}
+
+func fail(d *Detector, instance string, n int) {
+	for i := 0; i < n; i++ {
+		d.Record("svc", instance, 0, errors.New("connection refused"), time.Millisecond)
+	}
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	d := NewDetector(testConfig())
+	instances := []string{"a", "b"}
+
+	fail(d, "a", 2)
+	d.Record("svc", "a", 200, nil, time.Millisecond) // resets the streak
+	fail(d, "a", 2)
+	d.Record("svc", "a", 404, nil, time.Millisecond) // 4xx is not a failure
+	fail(d, "a", 2)
+	if got := d.Filter("svc", instances); !reflect.DeepEqual(got, instances) {
+		t.Fatalf("Filter = %v before the threshold, want %v", got, instances)
+	}
+
+	d.Record("svc", "a", 503, nil, time.Millisecond)
+	if got := d.Filter("svc", instances); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("Filter = %v after 3 failures in a row, want [b]", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got := d.Filter("svc", instances); !reflect.DeepEqual(got, instances) {
+		t.Errorf("Filter = %v after the ejection time, want %v", got, instances)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	cfg := testConfig()
+	cfg.ConsecutiveFailures = 0
+	cfg.ErrorRateThreshold = 0.5
+	cfg.MinRequests = 4
+	d := NewDetector(cfg)
+	d.Filter("svc", []string{"a", "b"})
+
+	fail(d, "a", 1)
+	d.Record("svc", "a", 200, nil, time.Millisecond)
+	fail(d, "a", 1)
+	if status := d.Status("svc")[0]; status.Ejected || status.ErrorRate < 0.66 || status.ErrorRate > 0.67 {
+		t.Fatalf("status = %+v below MinRequests, want not ejected with error rate 2/3", status)
+	}
+	d.Record("svc", "a", 200, nil, time.Millisecond)
+	if status := d.Status("svc")[0]; status.Ejected {
+		t.Fatalf("ejected on a success")
+	}
+	fail(d, "a", 1)
+	if status := d.Status("svc")[0]; !status.Ejected || status.Ejections != 1 {
+		t.Errorf("status = %+v at 3/5 failures, want ejected", status)
+	}
+}
+
+func TestLatencyThreshold(t *testing.T) {
+	cfg := testConfig()
+	cfg.LatencyThreshold = 50 * time.Millisecond
+	d := NewDetector(cfg)
+	d.Filter("svc", []string{"a", "b"})
+	for i := 0; i < 3; i++ {
+		d.Record("svc", "a", 200, nil, 80*time.Millisecond)
+	}
+	if got := d.Filter("svc", []string{"a", "b"}); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Filter = %v after slow responses, want [b]", got)
+	}
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxEjectionPercent = 50
+	d := NewDetector(cfg)
+	instances := []string{"a", "b", "c", "d"}
+	d.Filter("svc", instances)
+	for _, instance := range instances {
+		fail(d, instance, 3)
+	}
+	if got := d.Filter("svc", instances); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("Filter = %v, want half of the instances kept: [c d]", got)
+	}
+}
+
+func TestEjectionBackoffAndDecay(t *testing.T) {
+	d := NewDetector(testConfig())
+	d.Filter("svc", []string{"a", "b"})
+	ejectedFor := func() time.Duration {
+		t.Helper()
+		fail(d, "a", 3)
+		status := d.Status("svc")[0]
+		if !status.Ejected {
+			t.Fatalf("status = %+v, want ejected", status)
+		}
+		return time.Until(*status.EjectedUntil)
+	}
+
+	if got := ejectedFor(); got > 100*time.Millisecond {
+		t.Fatalf("first ejection lasts %v, want the base time", got)
+	}
+	time.Sleep(110 * time.Millisecond)
+	if got := ejectedFor(); got <= 100*time.Millisecond || got > 200*time.Millisecond {
+		t.Fatalf("second ejection lasts %v, want twice the base time", got)
+	}
+
+	// Two base periods back in rotation forget both ejections
+	time.Sleep(200*time.Millisecond + 250*time.Millisecond)
+	if status := d.Status("svc")[0]; status.Ejected || status.Ejections != 0 {
+		t.Fatalf("status = %+v after recovering, want no ejections left", status)
+	}
+	if got := ejectedFor(); got > 100*time.Millisecond {
+		t.Errorf("ejection after recovery lasts %v, want the base time again", got)
+	}
+}
+
+func TestFilterForgetsRemovedInstances(t *testing.T) {
+	d := NewDetector(testConfig())
+	d.Filter("svc", []string{"a", "b", "c"})
+	fail(d, "a", 3)
+	if got := d.Filter("svc", []string{"b", "c"}); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("Filter = %v, want [b c]", got)
+	}
+	for _, status := range d.Status("svc") {
+		if status.Instance == "a" {
+			t.Errorf("removed instance a still tracked: %+v", status)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// Check reports whether a dependency is usable; it must honour ctx.
+type Check func(ctx context.Context) error
+
+type component struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// ComponentStatus is the result of one check in the readiness output.
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Optional  bool    `json:"optional,omitempty"`
+	// Error can reveal hosts and driver details, so ReadyHandler leaves it
+	// out of the public output
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the JSON body of the liveness and readiness endpoints.
+type Report struct {
+	Status string                     `json:"status"`
+	Checks map[string]ComponentStatus `json:"checks,omitempty"`
+}
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusDegraded     = "degraded"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Checker runs dependency checks for readiness probes. Liveness only says the
+// process is serving; readiness fails when a required component is down or
+// shutdown has begun, so load balancers stop sending new traffic.
+type Checker struct {
+	timeout      time.Duration
+	mu           sync.Mutex
+	components   []component
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker giving each check at most timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check that must pass for the process to be ready.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components = append(c.components, component{name: name, check: check})
+}
+
+// AddOptional registers a check whose failure is reported as degraded but
+// does not fail readiness.
+func (c *Checker) AddOptional(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components = append(c.components, component{name: name, check: check, optional: true})
+}
+
+// SetShuttingDown makes readiness fail from now on.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) ShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Ready runs all checks concurrently and summarises them.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	components := append([]component{}, c.components...)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]ComponentStatus, len(components))
+	var wg sync.WaitGroup
+	for i, comp := range components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := comp.check(ctx)
+			results[i] = ComponentStatus{
+				Status:    StatusOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Optional:  comp.optional,
+			}
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]ComponentStatus, len(components))}
+	for i, comp := range components {
+		report.Checks[comp.name] = results[i]
+		if results[i].Status == StatusOK {
+			continue
+		}
+		if !comp.optional {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	if c.ShuttingDown() {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+// LiveHandler answers 200 while the process can serve requests at all.
+func (c *Checker) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	WriteReport(w, Report{Status: StatusOK})
+}
+
+// ReadyHandler answers with the result of Ready, see WriteReport. Failed
+// checks are reported by status and latency only; their errors are logged.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Ready(r.Context())
+	for name, check := range report.Checks {
+		if check.Error == "" {
+			continue
+		}
+		logger.FromContext(r.Context()).Warn("Readiness check failed", "component", name, "optional", check.Optional, "error", check.Error)
+		check.Error = ""
+		report.Checks[name] = check
+	}
+	WriteReport(w, report)
+}
+
+// WriteReport writes report as JSON with 200 when ready (possibly degraded)
+// and 503 otherwise.
+func WriteReport(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status == StatusFail || report.Status == StatusShuttingDown {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// DB checks that the database answers a ping.
+func DB(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Redis checks that a Redis server at addr answers PING. It speaks the
+// protocol directly so no client library is needed just for probing.
+func Redis(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			return err
+		}
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		reply = strings.TrimSpace(reply)
+		if reply != "+PONG" {
+			return fmt.Errorf("unexpected reply to PING: %q", reply)
+		}
+		return nil
+	}
+}
+
+// Func adapts a condition without I/O, such as "routes loaded", to a Check.
+func Func(fn func() error) Check {
+	return func(context.Context) error {
+		return fn()
+	}
+}
@@ -0,0 +1,118 @@
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy describes when a proxied request may be retried.
+type Policy struct {
+	// Attempts is the number of retries after the first attempt.
+	Attempts int
+	// RetryOn lists the upstream status codes that trigger a retry.
+	// Every transport error is retried too: refused or reset connections,
+	// but also response header timeouts, after which the upstream may have
+	// acted on the request. Methods outside IsIdempotent are therefore only
+	// retried when NonIdempotent is set.
+	RetryOn map[int]bool
+	// NonIdempotent allows retrying methods such as POST and PATCH.
+	NonIdempotent bool
+}
+
+// ParseStatusCodes parses a comma separated list such as "502,503,504".
+func ParseStatusCodes(list string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", field)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// Enabled reports whether the policy allows any retry for a method.
+func (p Policy) Enabled(method string) bool {
+	if p.Attempts <= 0 {
+		return false
+	}
+	return p.NonIdempotent || IsIdempotent(method)
+}
+
+// ShouldRetry reports whether an attempt with the given outcome is retried.
+func (p Policy) ShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp != nil && p.RetryOn[resp.StatusCode]
+}
+
+// IsIdempotent reports whether a method is idempotent per RFC 9110.
+func IsIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Backoff returns the delay before retry number attempt (starting at 1):
+// exponential growth from base capped at max, with full jitter.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Budget limits retries to a fraction of regular traffic across the whole
+// gateway so that a struggling upstream is not hit by a retry storm. Every
+// request deposits Ratio tokens and every retry withdraws one.
+type Budget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+}
+
+// NewBudget creates a budget allowing up to ratio extra load from retries
+// (e.g. 0.2 for 20%). maxTokens bounds the burst of retries that can
+// accumulate during quiet periods.
+func NewBudget(ratio float64, maxTokens float64) *Budget {
+	return &Budget{ratio: ratio, maxTokens: maxTokens}
+}
+
+// OnRequest records a regular (non-retry) request.
+func (b *Budget) OnRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// TryRetry reports whether a retry fits in the budget and, if so, spends it.
+func (b *Budget) TryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
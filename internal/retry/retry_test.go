@@ -0,0 +1,119 @@
+package retry
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		list string
+		want map[int]bool
+		err  string
+	}{
+		{list: "", want: map[int]bool{}},
+		{list: "502,503,504", want: map[int]bool{502: true, 503: true, 504: true}},
+		{list: " 429 , ,503", want: map[int]bool{429: true, 503: true}},
+		{list: "5xx", err: `invalid status code "5xx"`},
+		{list: "99", err: `invalid status code "99"`},
+		{list: "600", err: `invalid status code "600"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatusCodes(tt.list)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseStatusCodes(%q) error = %v, want %q", tt.list, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseStatusCodes(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := Policy{Attempts: 2, RetryOn: map[int]bool{503: true}}
+	for method, want := range map[string]bool{
+		http.MethodGet: true, http.MethodPut: true, http.MethodDelete: true,
+		http.MethodPost: false, http.MethodPatch: false,
+	} {
+		if got := p.Enabled(method); got != want {
+			t.Errorf("Enabled(%s) = %v, want %v", method, got, want)
+		}
+	}
+	if !(Policy{Attempts: 1, NonIdempotent: true}).Enabled(http.MethodPost) {
+		t.Error("NonIdempotent policy does not retry POST")
+	}
+	if (Policy{NonIdempotent: true}).Enabled(http.MethodGet) {
+		t.Error("policy without attempts retries")
+	}
+
+	tests := []struct {
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{err: errors.New("connection reset"), want: true},
+		{resp: &http.Response{StatusCode: 503}, want: true},
+		{resp: &http.Response{StatusCode: 502}, want: false},
+		{resp: &http.Response{StatusCode: 200}, want: false},
+		{want: false},
+	}
+	for _, tt := range tests {
+		if got := p.ShouldRetry(tt.resp, tt.err); got != tt.want {
+			t.Errorf("ShouldRetry(%v, %v) = %v, want %v", tt.resp, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	for attempt, ceiling := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		70: time.Second, // the shift overflows
+	} {
+		for i := 0; i < 100; i++ {
+			if got := Backoff(attempt, base, max); got < 0 || got > ceiling {
+				t.Fatalf("Backoff(%d) = %v, want within [0, %v]", attempt, got, ceiling)
+			}
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(0.5, 2)
+	if b.TryRetry() {
+		t.Fatal("retry allowed by an empty budget")
+	}
+	b.OnRequest()
+	if b.TryRetry() {
+		t.Fatal("retry allowed with half a token")
+	}
+	b.OnRequest()
+	if !b.TryRetry() {
+		t.Fatal("retry refused after two requests at ratio 0.5")
+	}
+	if b.TryRetry() {
+		t.Fatal("token spent twice")
+	}
+
+	// Quiet periods accumulate at most maxTokens
+	for i := 0; i < 100; i++ {
+		b.OnRequest()
+	}
+	allowed := 0
+	for b.TryRetry() {
+		allowed++
+	}
+	if allowed != 2 {
+		t.Errorf("burst of %d retries, want maxTokens = 2", allowed)
+	}
+}
@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+// exporter batches finished spans and posts them to an OTLP/HTTP collector
+// using the JSON encoding. Spans are dropped when the queue is full rather
+// than slowing down requests.
+type exporter struct {
+	endpoint      string
+	service       string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	queue   chan *Span
+	flushCh chan chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newExporter(cfg Config) *exporter {
+	e := &exporter{
+		endpoint:      cfg.Endpoint,
+		service:       cfg.ServiceName,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		flushCh:       make(chan chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = 512
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = 5 * time.Second
+	}
+	e.queue = make(chan *Span, 4*e.batchSize)
+	go e.run()
+	return e
+}
+
+func (e *exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		logger.Debug("Trace export queue full, dropping span", "span", s.name)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			logger.Warn("Failed to export spans", "count", len(batch), "endpoint", e.endpoint, "error", err)
+		}
+		batch = batch[:0]
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+				if len(batch) >= e.batchSize {
+					flush()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case ack := <-e.flushCh:
+			drain()
+			flush()
+			close(ack)
+			return
+		}
+	}
+}
+
+// shutdown exports everything queued and stops the exporter.
+func (e *exporter) shutdown(ctx context.Context) error {
+	var err error
+	e.once.Do(func() {
+		ack := make(chan struct{})
+		select {
+		case e.flushCh <- ack:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+		select {
+		case <-ack:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	})
+	return err
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// OTLP JSON payload, see opentelemetry-proto ExportTraceServiceRequest. IDs
+// are hex encoded and 64 bit integers are strings, as the JSON mapping
+// requires.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (e *exporter) encode(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			TraceState:        s.sc.TraceState,
+			Name:              s.name,
+			Kind:              int(s.kind),
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: int(s.status), Message: s.statusMessage},
+		}
+		if s.parentID.IsValid() {
+			span.ParentSpanID = s.parentID.String()
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpAttribute(a.key, a.value))
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", e.service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "psygateway"}, Spans: encoded}},
+	}}}
+}
+
+func otlpAttribute(key string, value any) otlpKeyValue {
+	var v map[string]any
+	switch value := value.(type) {
+	case string:
+		v = map[string]any{"stringValue": value}
+	case bool:
+		v = map[string]any{"boolValue": value}
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": value}
+	case time.Duration:
+		v = map[string]any{"intValue": strconv.FormatInt(value.Milliseconds(), 10)}
+	case error:
+		v = map[string]any{"stringValue": value.Error()}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
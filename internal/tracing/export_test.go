@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCollector is a stand-in OTLP/HTTP receiver that keeps every request.
+type testCollector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []otlpRequest
+}
+
+func newTestCollector(t *testing.T) *testCollector {
+	t.Helper()
+	c := &testCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, req)
+		c.mu.Unlock()
+	}))
+	c.URL += "/v1/traces"
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *testCollector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func attributeValue(span otlpSpan, key string) any {
+	for _, a := range span.Attributes {
+		if a.Key == key {
+			for _, v := range a.Value {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+func TestExportPayload(t *testing.T) {
+	collector := newTestCollector(t)
+	tracer := NewTracer(Config{ServiceName: "gateway", Endpoint: collector.URL, SampleRatio: 1})
+
+	ctx, parent := tracer.Start(context.Background(), "GET /users", KindServer)
+	_, child := tracer.Start(ctx, "upstream GET", KindClient)
+	child.SetAttributes("attempt", 2, "url.full", "http://users:3000/users", "retried", true, "ratio", 0.5, "elapsed", 1500*time.Millisecond)
+	child.SetError(errors.New("connection refused"))
+	child.End()
+	parent.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error = %v", err)
+	}
+
+	collector.mu.Lock()
+	requests := collector.requests
+	collector.mu.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(requests))
+	}
+	resource := requests[0].ResourceSpans[0].Resource
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Key != "service.name" || resource.Attributes[0].Value["stringValue"] != "gateway" {
+		t.Errorf("resource attributes = %+v, want service.name gateway", resource.Attributes)
+	}
+
+	spans := collector.spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	if gotChild.TraceID != parent.SpanContext().TraceID.String() || len(gotChild.TraceID) != 32 {
+		t.Errorf("traceId = %q, want hex %s", gotChild.TraceID, parent.SpanContext().TraceID)
+	}
+	if gotChild.SpanID != child.SpanContext().SpanID.String() || len(gotChild.SpanID) != 16 {
+		t.Errorf("spanId = %q, want hex %s", gotChild.SpanID, child.SpanContext().SpanID)
+	}
+	if gotChild.ParentSpanID != gotParent.SpanID {
+		t.Errorf("parentSpanId = %q, want %q", gotChild.ParentSpanID, gotParent.SpanID)
+	}
+	if gotParent.ParentSpanID != "" {
+		t.Errorf("root parentSpanId = %q, want none", gotParent.ParentSpanID)
+	}
+	if gotChild.Kind != int(KindClient) || gotParent.Kind != int(KindServer) {
+		t.Errorf("kinds = %d/%d, want %d/%d", gotChild.Kind, gotParent.Kind, KindClient, KindServer)
+	}
+
+	start, err := strconv.ParseInt(gotChild.StartTimeUnixNano, 10, 64)
+	if err != nil {
+		t.Fatalf("startTimeUnixNano %q is not a decimal string: %v", gotChild.StartTimeUnixNano, err)
+	}
+	end, err := strconv.ParseInt(gotChild.EndTimeUnixNano, 10, 64)
+	if err != nil || end < start || start != child.start.UnixNano() {
+		t.Errorf("times = %s..%s, want string nanos from %d", gotChild.StartTimeUnixNano, gotChild.EndTimeUnixNano, child.start.UnixNano())
+	}
+
+	if gotChild.Status.Code != int(StatusError) || gotChild.Status.Message != "connection refused" {
+		t.Errorf("child status = %+v, want error connection refused", gotChild.Status)
+	}
+	if gotParent.Status != (otlpStatus{}) {
+		t.Errorf("parent status = %+v, want unset", gotParent.Status)
+	}
+
+	attrs := map[string]any{
+		"attempt":  "2",
+		"url.full": "http://users:3000/users",
+		"retried":  true,
+		"ratio":    0.5,
+		"elapsed":  "1500",
+	}
+	for key, want := range attrs {
+		if got := attributeValue(gotChild, key); got != want {
+			t.Errorf("attribute %s = %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+func TestExportSkipsUnsampled(t *testing.T) {
+	collector := newTestCollector(t)
+	tracer := NewTracer(Config{ServiceName: "gateway", Endpoint: collector.URL, SampleRatio: 0})
+	_, span := tracer.Start(context.Background(), "op", KindInternal)
+	span.End()
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error = %v", err)
+	}
+	if spans := collector.spans(); len(spans) != 0 {
+		t.Errorf("exported %d unsampled spans", len(spans))
+	}
+}
+
+func TestExportBatches(t *testing.T) {
+	collector := newTestCollector(t)
+	tracer := NewTracer(Config{ServiceName: "gateway", Endpoint: collector.URL, SampleRatio: 1, BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		_, span := tracer.Start(context.Background(), "op", KindInternal)
+		span.End()
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error = %v", err)
+	}
+	collector.mu.Lock()
+	requests := len(collector.requests)
+	collector.mu.Unlock()
+	if requests != 3 || len(collector.spans()) != 5 {
+		t.Errorf("collector got %d spans in %d requests, want 5 in 3", len(collector.spans()), requests)
+	}
+}
+
+func TestExportCollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	e := &exporter{endpoint: server.URL, client: server.Client()}
+	_, span := NewTracer(Config{SampleRatio: 1}).Start(context.Background(), "op", KindInternal)
+	err := e.export([]*Span{span})
+	if err == nil || err.Error() != "collector returned 429 Too Many Requests: quota exceeded" {
+		t.Errorf("export error = %v, want the collector's status and message", err)
+	}
+}
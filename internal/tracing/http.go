@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Extract returns ctx continuing the trace described by the traceparent and
+// tracestate headers in h. Invalid headers are ignored and a new trace is
+// started by the next span.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	if state := h.Get(TracestateHeader); validTraceState(state) {
+		sc.TraceState = state
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Inject writes the current span context of ctx into h so the next hop joins
+// the same trace.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// Middleware traces every request handled by next with a server span on the
+// package-level tracer. Responses with a 5xx status mark the span as failed.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		ctx, span := Start(ctx, r.Method+" "+r.URL.Path, KindServer)
+		defer span.End()
+		span.SetAttributes("http.request.method", r.Method, "url.path", r.URL.Path)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes("http.response.status_code", sw.status)
+		if sw.status >= 500 {
+			span.SetStatus(StatusError, "HTTP "+strconv.Itoa(sw.status))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtractInject(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	in := http.Header{}
+	in.Set(TraceparentHeader, traceparent)
+	in.Set(TracestateHeader, "vendor=opaque")
+
+	ctx := Extract(context.Background(), in)
+	out := http.Header{}
+	Inject(ctx, out)
+	if got := out.Get(TraceparentHeader); got != traceparent {
+		t.Errorf("traceparent = %q, want %q", got, traceparent)
+	}
+	if got := out.Get(TracestateHeader); got != "vendor=opaque" {
+		t.Errorf("tracestate = %q, want vendor=opaque", got)
+	}
+
+	// A span started from the extracted context keeps the trace and
+	// becomes the parent of the next hop
+	ctx, span := NewTracer(Config{SampleRatio: 1}).Start(ctx, "op", KindClient)
+	out = http.Header{}
+	Inject(ctx, out)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext().SpanID.String() + "-01"
+	if got := out.Get(TraceparentHeader); got != want {
+		t.Errorf("traceparent after Start = %q, want %q", got, want)
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	for _, h := range []http.Header{
+		{},
+		{"Traceparent": {"garbage"}},
+		{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+	} {
+		ctx := Extract(context.Background(), h)
+		if sc := SpanContextFromContext(ctx); sc.IsValid() {
+			t.Errorf("Extract(%v) = %+v, want no span context", h, sc)
+		}
+		out := http.Header{}
+		out.Set(TracestateHeader, "stale=1")
+		Inject(ctx, out)
+		if len(out.Values(TraceparentHeader)) != 0 || out.Get(TracestateHeader) != "stale=1" {
+			t.Errorf("Inject without span context changed headers: %v", out)
+		}
+	}
+}
+
+func TestExtractDropsOversizedTracestate(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, strings.Repeat("k=v,", 40))
+	sc := SpanContextFromContext(Extract(context.Background(), h))
+	if !sc.IsValid() || sc.TraceState != "" {
+		t.Errorf("span context = %+v, want valid without tracestate", sc)
+	}
+
+	// Inject must not forward a tracestate the span context dropped
+	out := http.Header{}
+	out.Set(TracestateHeader, "k=v")
+	Inject(ContextWithRemoteSpanContext(context.Background(), sc), out)
+	if len(out.Values(TracestateHeader)) != 0 {
+		t.Errorf("tracestate = %q, want none", out.Get(TracestateHeader))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	collector := newTestCollector(t)
+	Configure(Config{ServiceName: "test", Endpoint: collector.URL, SampleRatio: 1})
+	t.Cleanup(func() { Configure(Config{SampleRatio: 1}) })
+
+	var downstream string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := http.Header{}
+		Inject(r.Context(), h)
+		downstream = h.Get(TraceparentHeader)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown error = %v", err)
+	}
+
+	spans := collector.spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /users/1" || span.Kind != int(KindServer) {
+		t.Errorf("span = %s kind %d, want GET /users/1 kind %d", span.Name, span.Kind, KindServer)
+	}
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("span trace/parent = %s/%s, want the incoming traceparent", span.TraceID, span.ParentSpanID)
+	}
+	if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; downstream != want {
+		t.Errorf("handler saw traceparent %q, want %q", downstream, want)
+	}
+	if span.Status.Code != int(StatusError) || span.Status.Message != "HTTP 502" {
+		t.Errorf("status = %+v, want error HTTP 502", span.Status)
+	}
+	if got := attributeValue(span, "http.response.status_code"); got != "502" {
+		t.Errorf("http.response.status_code = %v, want 502", got)
+	}
+}
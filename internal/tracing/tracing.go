@@ -0,0 +1,328 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Antimatterr/psygateway/internal/logger"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+const flagSampled = 0x01
+
+// SpanContext is the part of a span propagated between services in the W3C
+// traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+func (sc SpanContext) Sampled() bool { return sc.Flags&flagSampled != 0 }
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Versions above 00 are
+// accepted as long as their first four fields follow the 00 layout.
+func ParseTraceparent(value string) (SpanContext, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || (len(value) > 55 && (value[:2] == "00" || value[55] != '-')) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	parts := strings.Split(value[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if parts[0] == "ff" || strings.ToLower(parts[0]) != parts[0] {
+		return SpanContext{}, fmt.Errorf("unsupported traceparent version %q", parts[0])
+	}
+
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || strings.ToLower(parts[1]) != parts[1] {
+		return SpanContext{}, fmt.Errorf("invalid trace id in traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || strings.ToLower(parts[2]) != parts[2] {
+		return SpanContext{}, fmt.Errorf("invalid parent id in traceparent %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid flags in traceparent %q", value)
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("all-zero id in traceparent %q", value)
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+// validTraceState applies the size limits of the tracestate header; entries
+// are otherwise passed through untouched.
+func validTraceState(value string) bool {
+	return len(value) <= 512 && strings.Count(value, ",") < 32
+}
+
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span is one timed operation. Spans that are not sampled still carry IDs so
+// the trace continues downstream, but they are never exported.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     SpanKind
+	sc       SpanContext
+	parentID SpanID
+	start    time.Time
+
+	mu            sync.Mutex
+	end           time.Time
+	attrs         []attribute
+	status        StatusCode
+	statusMessage string
+	ended         bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttributes adds key/value pairs, in the same style as logger fields.
+func (s *Span) SetAttributes(args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			key = fmt.Sprint(args[i])
+		}
+		s.attrs = append(s.attrs, attribute{key: key, value: args[i+1]})
+	}
+}
+
+// SetError marks the span as failed with err; a nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = code
+	s.statusMessage = message
+}
+
+// End finishes the span and hands it to the exporter. Later calls are no-ops.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// Config selects where spans are exported and how root traces are sampled.
+type Config struct {
+	ServiceName string
+	// Endpoint is the full OTLP/HTTP traces URL, e.g.
+	// http://collector:4318/v1/traces. Empty disables export while still
+	// propagating trace context.
+	Endpoint string
+	// SampleRatio is the fraction of new traces that are sampled; traces
+	// started upstream follow the caller's decision.
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// ConfigFromEnv reads the standard OpenTelemetry variables OTEL_SERVICE_NAME,
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, OTEL_EXPORTER_OTLP_ENDPOINT (to which
+// /v1/traces is appended) and OTEL_TRACES_SAMPLER_ARG. service is used when
+// OTEL_SERVICE_NAME is unset.
+func ConfigFromEnv(service string) Config {
+	cfg := Config{ServiceName: service, SampleRatio: 1}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		cfg.ServiceName = name
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = endpoint
+	} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	if ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil {
+		cfg.SampleRatio = math.Max(0, math.Min(1, ratio))
+	}
+	return cfg
+}
+
+// Tracer creates spans for one service.
+type Tracer struct {
+	service  string
+	ratio    float64
+	exporter *exporter
+}
+
+func NewTracer(cfg Config) *Tracer {
+	t := &Tracer{service: cfg.ServiceName, ratio: cfg.SampleRatio}
+	if cfg.Endpoint != "" {
+		t.exporter = newExporter(cfg)
+	}
+	return t
+}
+
+// Start begins a span as a child of the span or remote context carried by
+// ctx, or as a new trace when there is none.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Flags = parent.Flags
+		span.sc.TraceState = parent.TraceState
+		span.parentID = parent.SpanID
+	} else {
+		rand.Read(span.sc.TraceID[:])
+		if t.sample() {
+			span.sc.Flags = flagSampled
+		}
+	}
+	rand.Read(span.sc.SpanID[:])
+
+	ctx = context.WithValue(ctx, spanContextKey{}, span.sc)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *Tracer) sample() bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	n := uint64(0)
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return float64(n>>11)/float64(1<<53) < t.ratio
+}
+
+// Shutdown flushes spans that have not been exported yet.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+type spanKey struct{}
+type spanContextKey struct{}
+
+// SpanFromContext returns the span started by the current request, or a
+// detached span that is never exported.
+func SpanFromContext(ctx context.Context) *Span {
+	if span, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return span
+	}
+	return &Span{tracer: &Tracer{}}
+}
+
+// SpanContextFromContext returns the current span context, which may come
+// from an incoming request (see Extract).
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a context whose spans continue the
+// remote trace sc.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// The package-level tracer is used by the helpers below so that services only
+// have to call Configure once at startup, like the logger.
+var defaultTracer atomic.Pointer[Tracer]
+
+func init() {
+	defaultTracer.Store(NewTracer(Config{SampleRatio: 1}))
+}
+
+// Configure replaces the package-level tracer. The previous one is flushed in
+// the background.
+func Configure(cfg Config) {
+	previous := defaultTracer.Swap(NewTracer(cfg))
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := previous.Shutdown(ctx); err != nil {
+			logger.Warn("Failed to flush previous tracer", err)
+		}
+	}()
+	if cfg.Endpoint != "" {
+		logger.Info("Exporting traces", "service", cfg.ServiceName, "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	}
+}
+
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// Start begins a span with the package-level tracer.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return Default().Start(ctx, name, kind)
+}
+
+// Shutdown flushes the package-level tracer.
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
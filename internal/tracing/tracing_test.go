@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		value   string
+		sampled bool
+		err     string
+	}{
+		{value: "00-" + traceID + "-" + spanID + "-01", sampled: true},
+		{value: "00-" + traceID + "-" + spanID + "-00"},
+		{value: "  00-" + traceID + "-" + spanID + "-01  ", sampled: true},
+		// Future versions may append fields after the 00 layout
+		{value: "01-" + traceID + "-" + spanID + "-01-extra", sampled: true},
+		{value: "01-" + traceID + "-" + spanID + "-01", sampled: true},
+
+		{value: "", err: "invalid traceparent"},
+		{value: "00-" + traceID + "-" + spanID + "-01-extra", err: "invalid traceparent"},
+		{value: "01-" + traceID + "-" + spanID + "-01extra", err: "invalid traceparent"},
+		{value: "00-" + traceID[:30] + "-" + spanID + "-0100", err: "invalid traceparent"},
+		{value: "00-" + traceID + "-" + spanID[:14] + "-0100", err: "invalid traceparent"},
+		{value: "00-" + traceID + "-" + spanID + "-1", err: "invalid traceparent"},
+		{value: "00_" + traceID + "-" + spanID + "-01", err: "invalid traceparent"},
+		{value: "ff-" + traceID + "-" + spanID + "-01", err: "unsupported traceparent version"},
+		{value: "0A-" + traceID + "-" + spanID + "-01", err: "unsupported traceparent version"},
+		{value: "00-" + strings.ToUpper(traceID) + "-" + spanID + "-01", err: "invalid trace id"},
+		{value: "00-" + traceID + "-" + strings.ToUpper(spanID) + "-01", err: "invalid parent id"},
+		{value: "00-" + strings.Repeat("z", 32) + "-" + spanID + "-01", err: "invalid trace id"},
+		{value: "00-" + traceID + "-" + spanID + "-zz", err: "invalid flags"},
+		{value: "00-" + strings.Repeat("0", 32) + "-" + spanID + "-01", err: "all-zero id"},
+		{value: "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", err: "all-zero id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseTraceparent error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTraceparent error = %v", err)
+			}
+			if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID {
+				t.Errorf("ids = %s/%s, want %s/%s", sc.TraceID, sc.SpanID, traceID, spanID)
+			}
+			if sc.Sampled() != tt.sampled {
+				t.Errorf("Sampled() = %v, want %v", sc.Sampled(), tt.sampled)
+			}
+			if !sc.Remote {
+				t.Error("parsed span context is not marked remote")
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	_, span := NewTracer(Config{SampleRatio: 1}).Start(context.Background(), "op", KindInternal)
+	sc := span.SpanContext()
+	parsed, err := ParseTraceparent(sc.Traceparent())
+	if err != nil {
+		t.Fatalf("ParseTraceparent(%q) error = %v", sc.Traceparent(), err)
+	}
+	if parsed.TraceID != sc.TraceID || parsed.SpanID != sc.SpanID || parsed.Flags != sc.Flags {
+		t.Errorf("round trip = %+v, want %+v", parsed, sc)
+	}
+}
+
+func TestStartSampling(t *testing.T) {
+	ctx := context.Background()
+	if _, span := NewTracer(Config{SampleRatio: 0}).Start(ctx, "op", KindInternal); span.SpanContext().Sampled() {
+		t.Error("new trace sampled with ratio 0")
+	}
+
+	// Children follow the parent's decision, whatever the ratio
+	parent := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Flags: flagSampled, TraceState: "k=v", Remote: true}
+	_, child := NewTracer(Config{SampleRatio: 0}).Start(ContextWithRemoteSpanContext(ctx, parent), "op", KindServer)
+	sc := child.SpanContext()
+	if sc.TraceID != parent.TraceID || !sc.Sampled() || sc.TraceState != "k=v" {
+		t.Errorf("child span context = %+v, want trace %s sampled with tracestate", sc, parent.TraceID)
+	}
+	if sc.SpanID == parent.SpanID || child.parentID != parent.SpanID {
+		t.Errorf("child span %s has parent %s, want a new span under %s", sc.SpanID, child.parentID, parent.SpanID)
+	}
+}
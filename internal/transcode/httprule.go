@@ -0,0 +1,155 @@
+package transcode
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Rule maps an HTTP method and path template to a gRPC method, like a
+// google.api.http annotation. Body names the request field filled from the
+// JSON body ("*" for the whole message, "" for none); ResponseBody names the
+// response field returned instead of the whole message.
+type Rule struct {
+	Method       string // full gRPC method name, package.Service/Method
+	HTTPMethod   string
+	Path         string
+	Body         string
+	ResponseBody string
+}
+
+// httpExtension is the field number of the google.api.http method option.
+const httpExtension = 72295728
+
+// annotatedRules reads the google.api.http option of method. The option is
+// decoded from the raw descriptor bytes so the gateway does not need the
+// generated googleapis packages to be linked in.
+func annotatedRules(method protoreflect.MethodDescriptor) ([]Rule, error) {
+	options := method.Options()
+	if options == nil {
+		return nil, nil
+	}
+	var rules []Rule
+	raw := options.ProtoReflect().GetUnknown()
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		raw = raw[n:]
+		if num != httpExtension || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, raw)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			raw = raw[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(raw)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		raw = raw[n:]
+		parsed, err := parseHTTPRule(value, fullMethodName(method), true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid google.api.http option on %s: %v", method.FullName(), err)
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// parseHTTPRule decodes a google.api.HttpRule message, including its
+// additional bindings when top is set (they may not nest further).
+func parseHTTPRule(b []byte, method string, top bool) ([]Rule, error) {
+	rule := Rule{Method: method}
+	var additional [][]byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case 2:
+			rule.HTTPMethod, rule.Path = "GET", string(value)
+		case 3:
+			rule.HTTPMethod, rule.Path = "PUT", string(value)
+		case 4:
+			rule.HTTPMethod, rule.Path = "POST", string(value)
+		case 5:
+			rule.HTTPMethod, rule.Path = "DELETE", string(value)
+		case 6:
+			rule.HTTPMethod, rule.Path = "PATCH", string(value)
+		case 7:
+			rule.Body = string(value)
+		case 8:
+			kind, path, err := parseCustomPattern(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.HTTPMethod, rule.Path = kind, path
+		case 11:
+			if top {
+				additional = append(additional, value)
+			}
+		case 12:
+			rule.ResponseBody = string(value)
+		}
+	}
+
+	rules := []Rule{rule}
+	for _, value := range additional {
+		more, err := parseHTTPRule(value, method, false)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, more...)
+	}
+	return rules, nil
+}
+
+// parseCustomPattern decodes google.api.CustomHttpPattern{kind, path}.
+func parseCustomPattern(b []byte) (kind, path string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		if typ == protowire.BytesType {
+			value, _ := protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				kind = string(value)
+			case 2:
+				path = string(value)
+			}
+		}
+		b = b[n:]
+	}
+	return kind, path, nil
+}
+
+func fullMethodName(method protoreflect.MethodDescriptor) string {
+	return string(method.Parent().FullName()) + "/" + string(method.Name())
+}
@@ -0,0 +1,202 @@
+package transcode
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// segmentKind is one part of a path template.
+type segmentKind int
+
+const (
+	segLiteral segmentKind = iota
+	segWildcard
+	segDeepWildcard // **, only allowed last
+)
+
+type segment struct {
+	kind    segmentKind
+	literal string
+}
+
+// variable binds the path segments [start, end) to a request field. end is
+// -1 for a variable ending in **, which takes the rest of the path.
+type variable struct {
+	fieldPath  string
+	start, end int
+}
+
+// pathTemplate is a parsed google.api.http path template such as
+// /v1/{name=shelves/*/books/*}:publish.
+type pathTemplate struct {
+	raw       string
+	segments  []segment
+	variables []variable
+	verb      string
+}
+
+// parseTemplate parses the template grammar of google/api/http.proto:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+func parseTemplate(raw string) (*pathTemplate, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", raw)
+	}
+	t := &pathTemplate{raw: raw}
+	rest := raw[1:]
+
+	// A verb follows the last colon outside of braces
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 && strings.LastIndexByte(rest, '}') < i {
+		rest, t.verb = rest[:i], rest[i+1:]
+	}
+
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, "{") {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("path template %q has an unterminated variable", raw)
+			}
+			if err := t.addVariable(rest[1:end]); err != nil {
+				return nil, fmt.Errorf("path template %q: %v", raw, err)
+			}
+			rest = rest[end+1:]
+		} else {
+			part, rest, _ = strings.Cut(rest, "/")
+			if err := t.addSegment(part); err != nil {
+				return nil, fmt.Errorf("path template %q: %v", raw, err)
+			}
+			continue
+		}
+		if rest != "" {
+			if rest[0] != '/' {
+				return nil, fmt.Errorf("path template %q: expected / after variable", raw)
+			}
+			rest = rest[1:]
+		}
+	}
+
+	for i, s := range t.segments {
+		if s.kind == segDeepWildcard && i != len(t.segments)-1 {
+			return nil, fmt.Errorf("path template %q: ** must be the last segment", raw)
+		}
+	}
+	return t, nil
+}
+
+func (t *pathTemplate) addSegment(part string) error {
+	switch {
+	case part == "*":
+		t.segments = append(t.segments, segment{kind: segWildcard})
+	case part == "**":
+		t.segments = append(t.segments, segment{kind: segDeepWildcard})
+	case part == "" || strings.ContainsAny(part, "{}="):
+		return fmt.Errorf("invalid segment %q", part)
+	default:
+		t.segments = append(t.segments, segment{kind: segLiteral, literal: part})
+	}
+	return nil
+}
+
+func (t *pathTemplate) addVariable(body string) error {
+	fieldPath, pattern, hasPattern := strings.Cut(body, "=")
+	if fieldPath == "" {
+		return fmt.Errorf("variable without a field path")
+	}
+	if !hasPattern {
+		pattern = "*"
+	}
+	v := variable{fieldPath: fieldPath, start: len(t.segments)}
+	for _, part := range strings.Split(pattern, "/") {
+		if err := t.addSegment(part); err != nil {
+			return err
+		}
+	}
+	v.end = len(t.segments)
+	if t.segments[v.end-1].kind == segDeepWildcard {
+		v.end = -1
+	}
+	t.variables = append(t.variables, v)
+	return nil
+}
+
+// literals counts literal segments; templates with more of them are more
+// specific and are matched first.
+func (t *pathTemplate) literals() int {
+	n := 0
+	for _, s := range t.segments {
+		if s.kind == segLiteral {
+			n++
+		}
+	}
+	return n
+}
+
+// match matches an escaped request path and returns the variable values.
+// Values of single-segment variables are unescaped; multi-segment values
+// keep their slashes escaped as sent.
+func (t *pathTemplate) match(escapedPath string) (map[string]string, bool) {
+	if !strings.HasPrefix(escapedPath, "/") {
+		return nil, false
+	}
+	rest := escapedPath[1:]
+	if t.verb != "" {
+		var verb string
+		i := strings.LastIndexByte(rest, ':')
+		if i < 0 || strings.IndexByte(rest[i:], '/') >= 0 {
+			return nil, false
+		}
+		rest, verb = rest[:i], rest[i+1:]
+		if verb != t.verb {
+			return nil, false
+		}
+	}
+
+	var parts []string
+	if rest != "" {
+		parts = strings.Split(rest, "/")
+	}
+	deep := len(t.segments) > 0 && t.segments[len(t.segments)-1].kind == segDeepWildcard
+	if deep {
+		if len(parts) < len(t.segments)-1 {
+			return nil, false
+		}
+	} else if len(parts) != len(t.segments) {
+		return nil, false
+	}
+	for i, s := range t.segments {
+		switch s.kind {
+		case segLiteral:
+			if parts[i] != s.literal {
+				return nil, false
+			}
+		case segWildcard:
+			if parts[i] == "" {
+				return nil, false
+			}
+		}
+	}
+
+	vars := make(map[string]string, len(t.variables))
+	for _, v := range t.variables {
+		end := v.end
+		if end < 0 {
+			end = len(parts)
+		}
+		if end-v.start == 1 {
+			value, err := url.PathUnescape(parts[v.start])
+			if err != nil {
+				return nil, false
+			}
+			vars[v.fieldPath] = value
+		} else {
+			vars[v.fieldPath] = strings.Join(parts[v.start:end], "/")
+		}
+	}
+	return vars, true
+}
@@ -0,0 +1,109 @@
+package transcode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		raw       string
+		segments  int
+		variables []variable
+		verb      string
+		err       string
+	}{
+		{raw: "/v1/users", segments: 2},
+		{raw: "/v1/users/{id}", segments: 3, variables: []variable{{"id", 2, 3}}},
+		{raw: "/v1/{name=shelves/*/books/*}", segments: 5, variables: []variable{{"name", 1, 5}}},
+		{raw: "/v1/{name=shelves/*}:publish", segments: 3, variables: []variable{{"name", 1, 3}}, verb: "publish"},
+		{raw: "/v1/{user.id}/posts/{post_id}", segments: 4, variables: []variable{{"user.id", 1, 2}, {"post_id", 3, 4}}},
+		{raw: "/v1/files/**", segments: 3},
+		{raw: "/v1/{path=files/**}", segments: 3, variables: []variable{{"path", 1, -1}}},
+		{raw: "/v1/*:list", segments: 2, verb: "list"},
+
+		{raw: "v1/users", err: "must start with /"},
+		{raw: "/v1/{id", err: "unterminated variable"},
+		{raw: "/v1/{id}x", err: "expected / after variable"},
+		{raw: "/v1/{=*}", err: "without a field path"},
+		{raw: "/v1/**/users", err: "** must be the last segment"},
+		{raw: "/v1/{path=**}/users", err: "** must be the last segment"},
+		{raw: "/v1//users", err: "invalid segment"},
+		{raw: "/v1/{a={b}}", err: "invalid segment"},
+		{raw: "/v1/a=b", err: "invalid segment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.raw)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseTemplate(%q) error = %v, want %q", tt.raw, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTemplate(%q) error = %v", tt.raw, err)
+			}
+			if len(tmpl.segments) != tt.segments {
+				t.Errorf("segments = %d, want %d", len(tmpl.segments), tt.segments)
+			}
+			if !reflect.DeepEqual(tmpl.variables, tt.variables) {
+				t.Errorf("variables = %+v, want %+v", tmpl.variables, tt.variables)
+			}
+			if tmpl.verb != tt.verb {
+				t.Errorf("verb = %q, want %q", tmpl.verb, tt.verb)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		vars     map[string]string // nil = no match
+	}{
+		{"/v1/users", "/v1/users", map[string]string{}},
+		{"/v1/users", "/v1/users/1", nil},
+		{"/v1/users", "/v1/groups", nil},
+		{"/v1/users/{id}", "/v1/users/42", map[string]string{"id": "42"}},
+		{"/v1/users/{id}", "/v1/users/a%20b", map[string]string{"id": "a b"}},
+		{"/v1/users/{id}", "/v1/users/a%2Fb", map[string]string{"id": "a/b"}},
+		{"/v1/users/{id}", "/v1/users/%zz", nil},
+		{"/v1/users/{id}", "/v1/users/", nil},
+		{"/v1/users/{id}", "v1/users/1", nil},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/s1/books/b%2F2", map[string]string{"name": "shelves/s1/books/b%2F2"}},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/s1/magazines/m1", nil},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves/s1:publish", map[string]string{"name": "shelves/s1"}},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves/s1:archive", nil},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves/s1", nil},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves:publish/s1", nil},
+		{"/v1/files/**", "/v1/files", map[string]string{}},
+		{"/v1/files/**", "/v1/files/a/b/c", map[string]string{}},
+		{"/v1/{path=files/**}", "/v1/files/a/b", map[string]string{"path": "files/a/b"}},
+		{"/v1/{path=files/**}", "/v1/other/a", nil},
+		{"/v1/{user.id}/posts/{post_id}", "/v1/7/posts/9", map[string]string{"user.id": "7", "post_id": "9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.path, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("parseTemplate(%q) error = %v", tt.template, err)
+			}
+			vars, ok := tmpl.match(tt.path)
+			if tt.vars == nil {
+				if ok {
+					t.Fatalf("match(%q) = %v, want no match", tt.path, vars)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("match(%q) did not match", tt.path)
+			}
+			if !reflect.DeepEqual(vars, tt.vars) {
+				t.Errorf("match(%q) = %v, want %v", tt.path, vars, tt.vars)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+// Package transcode turns JSON/HTTP requests into gRPC calls and gRPC
+// responses back into JSON, using the service descriptors of a protoset
+// (protoc --descriptor_set_out --include_imports) and google.api.http style
+// rules.
+package transcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MaxMessageSize bounds request bodies and single gRPC response messages;
+// a server streaming response may hold up to maxResponseSize in total.
+const (
+	MaxMessageSize  = 4 << 20
+	maxResponseSize = 16 << 20
+)
+
+// ErrBadRequest wraps failures caused by the client's request.
+var ErrBadRequest = errors.New("invalid request")
+
+// Binding is one HTTP mapping of a gRPC method.
+type Binding struct {
+	Rule
+	method   protoreflect.MethodDescriptor
+	template *pathTemplate
+}
+
+// GRPCPath is the HTTP/2 path of the gRPC method, /package.Service/Method.
+func (b *Binding) GRPCPath() string {
+	return "/" + b.Rule.Method
+}
+
+// Transcoder holds the bindings of one route.
+type Transcoder struct {
+	bindings []*Binding
+}
+
+// Load reads a protoset and builds bindings from the google.api.http options
+// of its methods plus rules, which take precedence for the same HTTP method
+// and path. Client streaming methods cannot be called from a single JSON
+// request and are rejected.
+func Load(protosetPath string, rules []Rule) (*Transcoder, error) {
+	data, err := os.ReadFile(protosetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protoset %s: %v", protosetPath, err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse protoset %s: %v", protosetPath, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protoset %s: %v", protosetPath, err)
+	}
+
+	t := &Transcoder{}
+	for _, rule := range rules {
+		if err := t.add(files, rule); err != nil {
+			return nil, err
+		}
+	}
+	var annotated []Rule
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				var more []Rule
+				if more, err = annotatedRules(methods.Get(j)); err != nil {
+					return false
+				}
+				annotated = append(annotated, more...)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range annotated {
+		if err := t.add(files, rule); err != nil {
+			return nil, err
+		}
+	}
+
+	// More specific templates win, e.g. /v1/users/me over /v1/users/{id}
+	sort.SliceStable(t.bindings, func(i, j int) bool {
+		return t.bindings[i].template.literals() > t.bindings[j].template.literals()
+	})
+	return t, nil
+}
+
+func (t *Transcoder) add(files *protoregistry.Files, rule Rule) error {
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(rule.Method, "/"), "/")
+	if !ok {
+		return fmt.Errorf("invalid gRPC method %q, expected package.Service/Method", rule.Method)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return fmt.Errorf("service %s not found in protoset", serviceName)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return fmt.Errorf("method %s not found in service %s", methodName, serviceName)
+	}
+	if method.IsStreamingClient() {
+		return fmt.Errorf("client streaming method %s cannot be transcoded", rule.Method)
+	}
+	if rule.HTTPMethod == "" || rule.Path == "" {
+		return fmt.Errorf("rule for %s has no HTTP method or path", rule.Method)
+	}
+	if rule.Body != "" && rule.Body != "*" && method.Input().Fields().ByName(protoreflect.Name(rule.Body)) == nil {
+		return fmt.Errorf("body field %s not found in %s", rule.Body, method.Input().FullName())
+	}
+	if rule.ResponseBody != "" && method.Output().Fields().ByName(protoreflect.Name(rule.ResponseBody)) == nil {
+		return fmt.Errorf("response body field %s not found in %s", rule.ResponseBody, method.Output().FullName())
+	}
+	template, err := parseTemplate(rule.Path)
+	if err != nil {
+		return err
+	}
+
+	rule.Method = fullMethodName(method)
+	rule.HTTPMethod = strings.ToUpper(rule.HTTPMethod)
+	for _, existing := range t.bindings {
+		if existing.HTTPMethod == rule.HTTPMethod && existing.Path == rule.Path {
+			return nil
+		}
+	}
+	t.bindings = append(t.bindings, &Binding{Rule: rule, method: method, template: template})
+	return nil
+}
+
+// Bindings returns the bindings in matching order.
+func (t *Transcoder) Bindings() []*Binding {
+	return t.bindings
+}
+
+// Match finds the binding for an HTTP method and escaped path and returns
+// the values of its path variables.
+func (t *Transcoder) Match(method, escapedPath string) (*Binding, map[string]string, bool) {
+	for _, b := range t.bindings {
+		if b.HTTPMethod != method {
+			continue
+		}
+		if vars, ok := b.template.match(escapedPath); ok {
+			return b, vars, true
+		}
+	}
+	return nil, nil, false
+}
+
+// EncodeRequest builds the request message from the JSON body, the path
+// variables and the query parameters of r, and returns it as a gRPC
+// length-prefixed message.
+func (b *Binding) EncodeRequest(r *http.Request, vars map[string]string) ([]byte, error) {
+	msg := dynamicpb.NewMessage(b.method.Input())
+
+	if b.Body != "" {
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxMessageSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > MaxMessageSize {
+			return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrBadRequest, MaxMessageSize)
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if b.Body != "*" {
+				// Wrapping the body in its field lets protojson handle
+				// fields of any type, not only messages
+				field := b.method.Input().Fields().ByName(protoreflect.Name(b.Body))
+				body = append(append([]byte(`{"`+field.JSONName()+`":`), body...), '}')
+			}
+			if err := protojson.Unmarshal(body, msg); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+			}
+		}
+	}
+
+	for fieldPath, value := range vars {
+		if err := setField(msg, fieldPath, []string{value}); err != nil {
+			return nil, fmt.Errorf("%w: path variable %s: %v", ErrBadRequest, fieldPath, err)
+		}
+	}
+
+	// With body "*" every field comes from the body
+	if b.Body != "*" {
+		for key, values := range r.URL.Query() {
+			if _, ok := vars[key]; ok {
+				continue
+			}
+			if err := setField(msg, key, values); err != nil {
+				if errors.Is(err, errUnknownField) {
+					continue
+				}
+				return nil, fmt.Errorf("%w: query parameter %s: %v", ErrBadRequest, key, err)
+			}
+		}
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return frame(data), nil
+}
+
+// DecodeResponse converts the gRPC messages in body to JSON: an object for
+// unary methods and an array of objects for server streaming ones.
+func (b *Binding) DecodeResponse(body []byte) ([]byte, error) {
+	var out [][]byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, fmt.Errorf("truncated gRPC message")
+		}
+		if body[0] != 0 {
+			return nil, fmt.Errorf("compressed gRPC messages are not supported")
+		}
+		size := binary.BigEndian.Uint32(body[1:5])
+		if size > MaxMessageSize || int(size) > len(body)-5 {
+			return nil, fmt.Errorf("invalid gRPC message length %d", size)
+		}
+		msg := dynamicpb.NewMessage(b.method.Output())
+		if err := proto.Unmarshal(body[5:5+size], msg); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", b.method.Output().FullName(), err)
+		}
+		body = body[5+size:]
+
+		encoded, err := b.marshalResponse(msg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, encoded)
+	}
+
+	if b.method.IsStreamingServer() {
+		return append(append([]byte("["), bytes.Join(out, []byte(","))...), ']'), nil
+	}
+	if len(out) != 1 {
+		return nil, fmt.Errorf("expected one response message, got %d", len(out))
+	}
+	return out[0], nil
+}
+
+var marshalOptions = protojson.MarshalOptions{EmitUnpopulated: true}
+
+func (b *Binding) marshalResponse(msg *dynamicpb.Message) ([]byte, error) {
+	encoded, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	// protojson deliberately varies its whitespace; clients get stable output
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, encoded); err != nil {
+		return nil, err
+	}
+	encoded = compact.Bytes()
+	if b.ResponseBody == "" {
+		return encoded, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	field := b.method.Output().Fields().ByName(protoreflect.Name(b.ResponseBody))
+	return fields[field.JSONName()], nil
+}
+
+// frame prefixes a message with the gRPC header: an uncompressed flag and
+// the big-endian length.
+func frame(data []byte) []byte {
+	framed := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(framed[1:5], uint32(len(data)))
+	copy(framed[5:], data)
+	return framed
+}
+
+var errUnknownField = errors.New("unknown field")
+
+// setField sets the field at a dotted path, accepting proto and JSON field
+// names. Repeated fields take every value, others the last one.
+func setField(msg protoreflect.Message, fieldPath string, values []string) error {
+	names := strings.Split(fieldPath, ".")
+	for i, name := range names {
+		fields := msg.Descriptor().Fields()
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			field = fields.ByJSONName(name)
+		}
+		if field == nil {
+			return errUnknownField
+		}
+
+		if i < len(names)-1 {
+			if field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() {
+				return fmt.Errorf("%s is not a message field", name)
+			}
+			msg = msg.Mutable(field).Message()
+			continue
+		}
+
+		if field.IsMap() || (field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.GroupKind) {
+			return fmt.Errorf("%s cannot be set from a string", name)
+		}
+		if field.IsList() {
+			list := msg.Mutable(field).List()
+			for _, s := range values {
+				value, err := parseScalar(field, s)
+				if err != nil {
+					return err
+				}
+				list.Append(value)
+			}
+			return nil
+		}
+		value, err := parseScalar(field, values[len(values)-1])
+		if err != nil {
+			return err
+		}
+		msg.Set(field, value)
+	}
+	return nil
+}
+
+func parseScalar(field protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.BytesKind:
+		v, err := base64.URLEncoding.DecodeString(s)
+		if err != nil {
+			v, err = base64.StdEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByName(protoreflect.Name(s)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown %s value %q", field.Enum().FullName(), s)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", field.Kind())
+	}
+}
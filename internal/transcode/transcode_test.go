@@ -0,0 +1,198 @@
+package transcode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testMessage builds test.Msg, a message with a field of every kind
+// setField handles:
+//
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Inner { string name = 1; }
+//	message Msg {
+//	  string s = 1; bool b = 2; int32 i32 = 3; int64 i64 = 4;
+//	  uint32 u32 = 5; uint64 u64 = 6; float f = 7; double d = 8;
+//	  bytes by = 9; Color color = 10; repeated int32 ids = 11;
+//	  Inner inner = 12; map<string, string> labels = 13;
+//	  repeated Inner items = 14; int32 page_size = 15;
+//	}
+func testMessage(t *testing.T) protoreflect.Message {
+	t.Helper()
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   kind.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("RED"), Number: proto.Int32(0)},
+				{Name: proto.String("GREEN"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, "")},
+			},
+			{
+				Name: proto.String("Msg"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("s", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("b", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, optional, ""),
+					field("i32", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+					field("i64", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+					field("u32", 5, descriptorpb.FieldDescriptorProto_TYPE_UINT32, optional, ""),
+					field("u64", 6, descriptorpb.FieldDescriptorProto_TYPE_UINT64, optional, ""),
+					field("f", 7, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, optional, ""),
+					field("d", 8, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+					field("by", 9, descriptorpb.FieldDescriptorProto_TYPE_BYTES, optional, ""),
+					field("color", 10, descriptorpb.FieldDescriptorProto_TYPE_ENUM, optional, ".test.Color"),
+					field("ids", 11, descriptorpb.FieldDescriptorProto_TYPE_INT32, repeated, ""),
+					field("inner", 12, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional, ".test.Inner"),
+					field("labels", 13, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.Msg.LabelsEntry"),
+					field("items", 14, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, repeated, ".test.Inner"),
+					field("page_size", 15, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("building test descriptor: %v", err)
+	}
+	return dynamicpb.NewMessage(fd.Messages().ByName("Msg"))
+}
+
+func TestSetField(t *testing.T) {
+	tests := []struct {
+		fieldPath string
+		values    []string
+		want      string // value read back with readField; unused when err is set
+		err       string
+	}{
+		{fieldPath: "s", values: []string{"hello"}, want: "hello"},
+		{fieldPath: "s", values: []string{"first", "last"}, want: "last"},
+		{fieldPath: "b", values: []string{"true"}, want: "true"},
+		{fieldPath: "i32", values: []string{"-7"}, want: "-7"},
+		{fieldPath: "u64", values: []string{"18446744073709551615"}, want: "18446744073709551615"},
+		{fieldPath: "d", values: []string{"1.5"}, want: "1.5"},
+		{fieldPath: "by", values: []string{"aGk="}, want: "hi"},
+		{fieldPath: "by", values: []string{"aGk-"}, want: "hi>"},
+		{fieldPath: "color", values: []string{"GREEN"}, want: "1"},
+		{fieldPath: "color", values: []string{"1"}, want: "1"},
+		{fieldPath: "ids", values: []string{"1", "2"}, want: "[1 2]"},
+		{fieldPath: "inner.name", values: []string{"x"}, want: "x"},
+		{fieldPath: "pageSize", values: []string{"10"}, want: "10"},
+
+		{fieldPath: "missing", values: []string{"x"}, err: "unknown field"},
+		{fieldPath: "inner.missing", values: []string{"x"}, err: "unknown field"},
+		{fieldPath: "s.name", values: []string{"x"}, err: "s is not a message field"},
+		{fieldPath: "items.name", values: []string{"x"}, err: "items is not a message field"},
+		{fieldPath: "labels.key", values: []string{"x"}, err: "labels is not a message field"},
+		{fieldPath: "inner", values: []string{"x"}, err: "inner cannot be set from a string"},
+		{fieldPath: "labels", values: []string{"x"}, err: "labels cannot be set from a string"},
+		{fieldPath: "b", values: []string{"yes"}, err: "invalid syntax"},
+		{fieldPath: "i32", values: []string{"2147483648"}, err: "out of range"},
+		{fieldPath: "i64", values: []string{"1.0"}, err: "invalid syntax"},
+		{fieldPath: "u32", values: []string{"-1"}, err: "invalid syntax"},
+		{fieldPath: "f", values: []string{"fast"}, err: "invalid syntax"},
+		{fieldPath: "by", values: []string{"!!"}, err: "illegal base64"},
+		{fieldPath: "color", values: []string{"BLUE"}, err: `unknown test.Color value "BLUE"`},
+		{fieldPath: "ids", values: []string{"1", "x"}, err: "invalid syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldPath+"="+strings.Join(tt.values, ","), func(t *testing.T) {
+			msg := testMessage(t)
+			err := setField(msg, tt.fieldPath, tt.values)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("setField error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setField error = %v", err)
+			}
+			if got := readField(msg, tt.fieldPath); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.fieldPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFieldUnknownIsDetectable(t *testing.T) {
+	// EncodeRequest ignores unknown query parameters through this sentinel
+	if err := setField(testMessage(t), "nope", []string{"x"}); !errors.Is(err, errUnknownField) {
+		t.Fatalf("setField error = %v, want errUnknownField", err)
+	}
+}
+
+func TestParseScalarUnsupportedKind(t *testing.T) {
+	msg := testMessage(t)
+	field := msg.Descriptor().Fields().ByName("inner")
+	if _, err := parseScalar(field, "x"); err == nil || !strings.Contains(err.Error(), "unsupported field type") {
+		t.Fatalf("parseScalar error = %v, want unsupported field type", err)
+	}
+}
+
+// readField returns the value at fieldPath formatted for comparison: bytes
+// as a string, enums as their number and lists as [a b].
+func readField(msg protoreflect.Message, fieldPath string) string {
+	names := strings.Split(fieldPath, ".")
+	for i, name := range names {
+		fields := msg.Descriptor().Fields()
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			field = fields.ByJSONName(name)
+		}
+		value := msg.Get(field)
+		if i < len(names)-1 {
+			msg = value.Message()
+			continue
+		}
+		switch {
+		case field.IsList():
+			parts := make([]string, value.List().Len())
+			for j := range parts {
+				parts[j] = value.List().Get(j).String()
+			}
+			return "[" + strings.Join(parts, " ") + "]"
+		case field.Kind() == protoreflect.BytesKind:
+			return string(value.Bytes())
+		default:
+			return value.String()
+		}
+	}
+	return ""
+}
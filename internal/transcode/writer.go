@@ -0,0 +1,127 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Antimatterr/psygateway/internal/gatewayerr"
+)
+
+// errResponseTooLarge stops buffering of responses that cannot be converted
+// anyway.
+var errResponseTooLarge = errors.New("gRPC response too large to transcode")
+
+// ResponseWriter sits between the proxy and the client of a transcoded
+// request. gRPC responses are buffered so they can be converted once their
+// trailers arrived; anything else, such as an error the gateway rendered for
+// the client, passes through unchanged.
+type ResponseWriter struct {
+	w       http.ResponseWriter
+	header  http.Header
+	status  int
+	grpc    bool
+	passing bool
+	body    bytes.Buffer
+}
+
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{w: w, header: make(http.Header)}
+}
+
+func (rw *ResponseWriter) Header() http.Header {
+	if rw.passing {
+		return rw.w.Header()
+	}
+	return rw.header
+}
+
+func (rw *ResponseWriter) WriteHeader(status int) {
+	if rw.status != 0 {
+		return
+	}
+	rw.status = status
+	if mediaType, _, _ := mime.ParseMediaType(rw.header.Get("Content-Type")); mediaType == "application/grpc" || strings.HasPrefix(mediaType, "application/grpc+") {
+		rw.grpc = true
+		return
+	}
+	rw.passing = true
+	for key, values := range rw.header {
+		rw.w.Header()[key] = values
+	}
+	rw.w.WriteHeader(status)
+}
+
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.passing {
+		return rw.w.Write(p)
+	}
+	if rw.body.Len()+len(p) > maxResponseSize {
+		return 0, errResponseTooLarge
+	}
+	return rw.body.Write(p)
+}
+
+// Flush forwards flushes of passed through responses; buffered gRPC
+// responses have nothing to flush.
+func (rw *ResponseWriter) Flush() {
+	if rw.passing {
+		http.NewResponseController(rw.w).Flush()
+	}
+}
+
+// GRPC reports whether a gRPC response was buffered and still needs to be
+// written to the client.
+func (rw *ResponseWriter) GRPC() bool {
+	return rw.grpc
+}
+
+// Body returns the buffered gRPC messages.
+func (rw *ResponseWriter) Body() []byte {
+	return rw.body.Bytes()
+}
+
+// Status returns the gRPC status of the buffered response, found in the
+// trailers or, for trailers-only responses, in the headers.
+func (rw *ResponseWriter) Status() (gatewayerr.GRPCCode, string) {
+	value := rw.header.Get(http.TrailerPrefix + "Grpc-Status")
+	message := rw.header.Get(http.TrailerPrefix + "Grpc-Message")
+	if value == "" {
+		value = rw.header.Get("Grpc-Status")
+		message = rw.header.Get("Grpc-Message")
+	}
+	if value == "" {
+		return gatewayerr.GRPCUnknown, "upstream response carried no grpc-status"
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return gatewayerr.GRPCUnknown, "upstream sent an invalid grpc-status " + strconv.Quote(value)
+	}
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	return gatewayerr.GRPCCode(code), message
+}
+
+type originalRequestKey struct{}
+
+// NewContext records the client's original request in the context of the
+// gRPC request built from it.
+func NewContext(ctx context.Context, original *http.Request) context.Context {
+	return context.WithValue(ctx, originalRequestKey{}, original)
+}
+
+// Original returns the client request r was transcoded from, or nil when r
+// was not transcoded.
+func Original(r *http.Request) *http.Request {
+	original, _ := r.Context().Value(originalRequestKey{}).(*http.Request)
+	return original
+}
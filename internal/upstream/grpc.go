@@ -0,0 +1,58 @@
+package upstream
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsGRPC reports whether r is a gRPC call: content type application/grpc,
+// optionally with a +proto or +json suffix. gRPC-Web is not included.
+func IsGRPC(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// grpcTimeoutUnits are the units of the grpc-timeout header.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// GRPCTimeout parses the grpc-timeout header of a call, e.g. "250m" or "5S".
+func GRPCTimeout(h http.Header) (time.Duration, bool) {
+	value := h.Get("Grpc-Timeout")
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// FormatGRPCTimeout encodes d for the grpc-timeout header, rounded up so a
+// short remaining deadline is not sent as zero. The header allows at most
+// eight digits, so long timeouts are sent in seconds.
+func FormatGRPCTimeout(d time.Duration) string {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+	if ms > 99999999 {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "S"
+	}
+	return strconv.FormatInt(int64(ms), 10) + "m"
+}
@@ -0,0 +1,264 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Settings tunes the connection pool used for one upstream service.
+type Settings struct {
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // 0 = unlimited
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DialTimeout         time.Duration
+	// HTTP2 speaks HTTP/2 only: negotiated via ALPN for https targets and
+	// with prior knowledge (h2c) for plain http targets.
+	HTTP2 bool
+	TLS   TLSFiles
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         5 * time.Second,
+	}
+}
+
+type connectTimeoutKey struct{}
+
+// WithConnectTimeout overrides the dial timeout for requests made with ctx.
+func WithConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// Stats describes a service's pool. Idle connections are those open but not
+// serving a request.
+type Stats struct {
+	Service        string `json:"service"`
+	OpenConns      int64  `json:"open_conns"`
+	ActiveRequests int64  `json:"active_requests"`
+	NewConns       int64  `json:"new_conns"`
+	ReusedConns    int64  `json:"reused_conns"`
+	DialErrors     int64  `json:"dial_errors"`
+}
+
+// pool is one service's transport and its counters.
+type pool struct {
+	settings  Settings
+	transport *http.Transport
+	client    *http.Client
+
+	open   atomic.Int64
+	active atomic.Int64
+	fresh  atomic.Int64
+	reused atomic.Int64
+	failed atomic.Int64
+}
+
+// Pools hands out one HTTP client per upstream service, each with its own
+// transport so a slow or busy service cannot exhaust another's connections.
+type Pools struct {
+	mu       sync.Mutex
+	defaults Settings
+	settings map[string]Settings
+	pools    map[string]*pool
+}
+
+func NewPools(defaults Settings) *Pools {
+	return &Pools{defaults: defaults, settings: make(map[string]Settings), pools: make(map[string]*pool)}
+}
+
+// Configure sets the settings for services, replacing previous ones.
+// Services not listed use the defaults. Existing pools whose settings change
+// are rebuilt; their idle connections are closed and requests in flight
+// finish on the old transport.
+func (p *Pools) Configure(settings map[string]Settings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.settings = settings
+	for service, existing := range p.pools {
+		if p.settingsFor(service) != existing.settings {
+			existing.transport.CloseIdleConnections()
+			delete(p.pools, service)
+		}
+	}
+}
+
+func (p *Pools) settingsFor(service string) Settings {
+	if s, ok := p.settings[service]; ok {
+		return s
+	}
+	return p.defaults
+}
+
+func (p *Pools) get(service string) (*pool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if existing, ok := p.pools[service]; ok {
+		return existing, nil
+	}
+	pl, err := newPool(p.settingsFor(service))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings for %s: %v", service, err)
+	}
+	p.pools[service] = pl
+	return pl, nil
+}
+
+// Client returns the HTTP client of service's pool, for requests that
+// should not count in its statistics, such as health checks.
+func (p *Pools) Client(service string) (*http.Client, error) {
+	pl, err := p.get(service)
+	if err != nil {
+		return nil, err
+	}
+	return pl.client, nil
+}
+
+// Do sends req with the pool of service. The request counts as active until
+// the response body is closed.
+func (p *Pools) Do(service string, req *http.Request) (*http.Response, error) {
+	pl, err := p.get(service)
+	if err != nil {
+		return nil, err
+	}
+	pl.active.Add(1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				pl.reused.Add(1)
+			} else {
+				pl.fresh.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := pl.client.Do(req)
+	if err != nil {
+		pl.active.Add(-1)
+		return nil, err
+	}
+	body := &activeBody{ReadCloser: resp.Body, active: &pl.active}
+	if rw, ok := resp.Body.(io.ReadWriteCloser); ok {
+		// Switching Protocols responses hand out the connection itself
+		resp.Body = &activeUpgradeBody{activeBody: body, Writer: rw}
+	} else {
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+type activeBody struct {
+	io.ReadCloser
+	active *atomic.Int64
+	closed atomic.Bool
+}
+
+func (b *activeBody) Close() error {
+	if b.closed.CompareAndSwap(false, true) {
+		b.active.Add(-1)
+	}
+	return b.ReadCloser.Close()
+}
+
+type activeUpgradeBody struct {
+	*activeBody
+	io.Writer
+}
+
+// Stats returns pool statistics ordered by service name.
+func (p *Pools) Stats() []Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]Stats, 0, len(p.pools))
+	for service, pl := range p.pools {
+		stats = append(stats, Stats{
+			Service:        service,
+			OpenConns:      pl.open.Load(),
+			ActiveRequests: pl.active.Load(),
+			NewConns:       pl.fresh.Load(),
+			ReusedConns:    pl.reused.Load(),
+			DialErrors:     pl.failed.Load(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Service < stats[j].Service })
+	return stats
+}
+
+// CloseIdleConnections closes idle connections of every pool.
+func (p *Pools) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pl := range p.pools {
+		pl.transport.CloseIdleConnections()
+	}
+}
+
+func newPool(s Settings) (*pool, error) {
+	tlsConfig, err := ClientTLS(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+	pl := &pool{settings: s}
+	dialer := &net.Dialer{Timeout: s.DialTimeout, KeepAlive: s.KeepAlive}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0 // bounded per host below
+	transport.MaxIdleConnsPerHost = s.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = s.MaxConnsPerHost
+	transport.IdleConnTimeout = s.IdleConnTimeout
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			pl.failed.Add(1)
+			return nil, err
+		}
+		pl.open.Add(1)
+		return &trackedConn{Conn: conn, open: &pl.open}, nil
+	}
+	if s.HTTP2 {
+		var protocols http.Protocols
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = &protocols
+	}
+
+	pl.transport = transport
+	pl.client = &http.Client{Transport: transport}
+	return pl, nil
+}
+
+// trackedConn decrements the open connection count once when closed.
+type trackedConn struct {
+	net.Conn
+	open   *atomic.Int64
+	closed atomic.Bool
+}
+
+func (c *trackedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
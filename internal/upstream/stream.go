@@ -0,0 +1,134 @@
+package upstream
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IsStreaming reports whether resp should reach the client as it arrives
+// rather than when buffers fill: server-sent events and bodies of unknown
+// length (chunked), which long-polling endpoints typically use.
+func IsStreaming(resp *http.Response) bool {
+	return IsEventStream(resp) || resp.ContentLength == -1
+}
+
+// IsEventStream reports whether resp is a server-sent event stream.
+func IsEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// CopyBody copies body to w. With interval < 0 every write is flushed
+// immediately; with interval > 0 data is flushed at most that long after it
+// was written; 0 leaves flushing to the server's buffering.
+func CopyBody(w http.ResponseWriter, body io.Reader, interval time.Duration) (int64, error) {
+	if interval == 0 {
+		return io.Copy(w, body)
+	}
+
+	fw := &flushWriter{w: w, rc: http.NewResponseController(w), interval: interval}
+	defer fw.stop()
+	// io.Copy would prefer w's ReadFrom, which bypasses our flushing
+	return io.Copy(struct{ io.Writer }{fw}, body)
+}
+
+// flushWriter flushes after each write or, with a positive interval, from a
+// timer armed by the first unflushed write.
+type flushWriter struct {
+	w        io.Writer
+	rc       *http.ResponseController
+	interval time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+	stopped bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f.interval < 0 {
+		f.rc.Flush()
+		return n, nil
+	}
+	if !f.pending {
+		f.pending = true
+		if f.timer == nil {
+			f.timer = time.AfterFunc(f.interval, f.delayedFlush)
+		} else {
+			f.timer.Reset(f.interval)
+		}
+	}
+	return n, nil
+}
+
+func (f *flushWriter) delayedFlush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending && !f.stopped {
+		f.rc.Flush()
+	}
+	f.pending = false
+}
+
+func (f *flushWriter) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
+
+// IdleReader reads a response body and calls cancel, which must abort the
+// body's request, once no data arrived for its idle timeout. It bounds
+// streams that are exempt from the total request timeout.
+type IdleReader struct {
+	body  io.Reader
+	idle  time.Duration
+	timer *time.Timer
+	fired atomic.Bool
+}
+
+// NewIdleReader starts the idle timer; Stop must be called once reading is
+// done. idle <= 0 disables the timeout.
+func NewIdleReader(body io.Reader, idle time.Duration, cancel func()) *IdleReader {
+	r := &IdleReader{body: body, idle: idle}
+	if idle > 0 {
+		r.timer = time.AfterFunc(idle, func() {
+			r.fired.Store(true)
+			cancel()
+		})
+	}
+	return r
+}
+
+func (r *IdleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if r.timer == nil {
+		return n, err
+	}
+	if r.fired.Load() {
+		return n, ErrIdleTimeout
+	}
+	if n > 0 {
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+func (r *IdleReader) Stop() {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
@@ -0,0 +1,101 @@
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSFiles configures TLS towards the https targets of a service. The zero
+// value verifies servers against the system roots and presents no client
+// certificate.
+type TLSFiles struct {
+	CAFile     string // PEM bundle trusted for server certificates, '' = system roots
+	CertFile   string // client certificate presented to the upstream
+	KeyFile    string
+	ServerName string // name expected in server certificates, '' = target host
+}
+
+// ClientTLS builds the TLS configuration for calling a service. The client
+// certificate is read again whenever its file changes, so rotating it on
+// disk needs no restart.
+func ClientTLS(files TLSFiles) (*tls.Config, error) {
+	config := &tls.Config{ServerName: files.ServerName}
+	if files.CAFile != "" {
+		pem, err := os.ReadFile(files.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", files.CAFile)
+		}
+		config.RootCAs = roots
+	}
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be given together")
+	}
+	if files.CertFile != "" {
+		cert := &clientCertificate{certFile: files.CertFile, keyFile: files.KeyFile}
+		if _, err := cert.get(); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+	return config, nil
+}
+
+// clientCertificate caches a key pair until either file is modified.
+type clientCertificate struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *clientCertificate) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil && modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Keep the previous pair while a rotation is half written
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	c.cert, c.modTime = &cert, modTime
+	return c.cert, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
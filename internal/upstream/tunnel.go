@@ -0,0 +1,181 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IsUpgrade reports whether r asks to switch protocols, e.g. to WebSocket,
+// and returns the requested protocol.
+func IsUpgrade(r *http.Request) (string, bool) {
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				protocol := r.Header.Get("Upgrade")
+				return protocol, protocol != ""
+			}
+		}
+	}
+	return "", false
+}
+
+// ErrIdleTimeout ends a tunnel or a streamed response body that carried no
+// data for its idle timeout.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// Relay copies data in both directions between client and backend until one
+// side closes, an error occurs or nothing was transferred for idle (0
+// disables the idle timeout). Both connections are closed on return. It
+// returns the bytes sent to the backend and to the client.
+func Relay(client, backend io.ReadWriteCloser, idle time.Duration) (toBackend, toClient int64, err error) {
+	var closeOnce sync.Once
+	var idled atomic.Bool
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			client.Close()
+			backend.Close()
+		})
+	}
+	defer closeBoth()
+
+	var timer *time.Timer
+	if idle > 0 {
+		timer = time.AfterFunc(idle, func() {
+			idled.Store(true)
+			closeBoth()
+		})
+		defer timer.Stop()
+	}
+	activity := func() {
+		if timer != nil {
+			timer.Reset(idle)
+		}
+	}
+
+	type result struct {
+		n   int64
+		err error
+	}
+	up := make(chan result, 1)
+	down := make(chan result, 1)
+	go func() {
+		n, err := io.Copy(&activityWriter{w: backend, onWrite: activity}, client)
+		up <- result{n, err}
+	}()
+	go func() {
+		n, err := io.Copy(&activityWriter{w: client, onWrite: activity}, backend)
+		down <- result{n, err}
+	}()
+
+	// The first direction to finish ends the tunnel; closing both sides
+	// unblocks the other copy
+	var first result
+	select {
+	case first = <-up:
+		closeBoth()
+		toBackend = first.n
+		toClient = (<-down).n
+	case first = <-down:
+		closeBoth()
+		toClient = first.n
+		toBackend = (<-up).n
+	}
+
+	switch {
+	case idled.Load():
+		err = ErrIdleTimeout
+	case first.err != nil && !errors.Is(first.err, net.ErrClosed):
+		err = first.err
+	}
+	return toBackend, toClient, err
+}
+
+type activityWriter struct {
+	w       io.Writer
+	onWrite func()
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	n, err := a.w.Write(p)
+	if n > 0 {
+		a.onWrite()
+	}
+	return n, err
+}
+
+// Tunnels tracks open tunnels. http.Server.Shutdown does not wait for
+// hijacked connections, so shutdown drains them through Drain.
+type Tunnels struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	next     int
+	closes   map[int]func()
+	draining bool
+}
+
+func NewTunnels() *Tunnels {
+	return &Tunnels{closes: make(map[int]func())}
+}
+
+// Add registers a tunnel that closeConns tears down. The returned function
+// must be called once the tunnel has ended. Once Drain started, new tunnels
+// are refused and closed right away.
+func (t *Tunnels) Add(closeConns func()) (done func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		closeConns()
+		return func() {}
+	}
+	// Only while not draining, so wg.Add never races Drain's wg.Wait
+	t.wg.Add(1)
+	id := t.next
+	t.next++
+	t.closes[id] = closeConns
+	return func() {
+		t.mu.Lock()
+		delete(t.closes, id)
+		t.mu.Unlock()
+		t.wg.Done()
+	}
+}
+
+// Drain waits for open tunnels to end until ctx is done, then closes the
+// remaining ones and waits for their relays to return. It returns the
+// number of tunnels it closed.
+func (t *Tunnels) Drain(ctx context.Context) int {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		return 0
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	closes := make([]func(), 0, len(t.closes))
+	for _, closeConns := range t.closes {
+		closes = append(closes, closeConns)
+	}
+	t.mu.Unlock()
+	for _, closeConns := range closes {
+		closeConns()
+	}
+	<-ended
+	return len(closes)
+}
@@ -1,20 +1,46 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/Antimatterr/psygateway/internal/accesslog"
+	"github.com/Antimatterr/psygateway/internal/certs"
+	"github.com/Antimatterr/psygateway/internal/circuitbreaker"
 	"github.com/Antimatterr/psygateway/internal/discovery"
+	"github.com/Antimatterr/psygateway/internal/gatewayerr"
+	"github.com/Antimatterr/psygateway/internal/healthcheck"
 	"github.com/Antimatterr/psygateway/internal/logger"
+	"github.com/Antimatterr/psygateway/internal/metrics"
+	"github.com/Antimatterr/psygateway/internal/outlier"
+	"github.com/Antimatterr/psygateway/internal/probe"
+	"github.com/Antimatterr/psygateway/internal/retry"
+	"github.com/Antimatterr/psygateway/internal/tracing"
+	"github.com/Antimatterr/psygateway/internal/transcode"
+	"github.com/Antimatterr/psygateway/internal/upstream"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 type Route struct {
@@ -28,16 +54,281 @@ type Route struct {
 	TargetURL    string
 	Enabled      bool
 	UseConsul    bool
+
+	// Active health checking of static targets, disabled when the path is empty
+	HealthCheckPath     string
+	HealthCheckInterval int // seconds
+	HealthCheckTimeout  int // seconds
+	HealthyThreshold    int
+	UnhealthyThreshold  int
+
+	// Retries of failed upstream attempts
+	RetryAttempts      int
+	RetryOn            string // comma separated status codes
+	RetryNonIdempotent bool
+	RetryPolicy        retry.Policy
+
+	// Upstream timeouts in milliseconds, 0 = gateway default
+	ConnectTimeoutMs        int
+	ResponseHeaderTimeoutMs int
+	RequestTimeoutMs        int
+
+	// Custom HTML error page, '' = built-in page
+	ErrorPageTemplate string
+	ErrorPage         *template.Template
+
+	// Response flushing: Streaming flushes every write even when the
+	// response does not look like a stream; FlushIntervalMs > 0 flushes
+	// periodically instead
+	Streaming       bool
+	FlushIntervalMs int
+
+	// Tunnel WebSocket and other HTTP Upgrade requests to the upstream
+	AllowUpgrade bool
+
+	// The upstream serves gRPC: request paths (/package.Service/Method) are
+	// forwarded unchanged and the service is called over HTTP/2
+	GRPC bool
+
+	// JSON/HTTP requests are transcoded to gRPC calls using this descriptor
+	// set and its google.api.http options plus the route's grpc_http_rules,
+	// '' = no transcoding
+	GRPCProtoset string
+	Transcoder   *transcode.Transcoder
+
+	// Host the route serves: api.example.com or *.example.com, '' = any.
+	// Exact hosts also get ACME certificates when ACME is enabled
+	HostPattern string
+
+	// Client certificates (mTLS): requests must present a certificate issued
+	// by a CA in this PEM bundle, '' = not required. ClientCertSubjects,
+	// from auth_rules, limits the accepted common names and SANs
+	ClientCAFile       string
+	ClientCAs          *x509.CertPool
+	ClientCertSubjects []string
+}
+
+// requestIDHeader correlates a request across the gateway and backend logs.
+const requestIDHeader = "X-Request-ID"
+
+// Identity of a verified client certificate, passed to the upstream. Both
+// are removed from incoming requests so clients cannot forge them.
+const (
+	clientCertSubjectHeader = "X-Client-Cert-Subject"
+	clientCertSANHeader     = "X-Client-Cert-SAN"
+)
+
+// deadlineHeader carries the milliseconds left before the gateway gives up on
+// a request, so upstreams can stop working on requests nobody waits for.
+const deadlineHeader = "X-Request-Deadline"
+
+// Targets returns the static upstream URLs of the route. target_url may hold
+// several comma separated URLs to balance across.
+func (r *Route) Targets() []string {
+	var targets []string
+	for _, target := range strings.Split(r.TargetURL, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// GatewayConfig holds the tunables of the proxy path that are read from the
+// environment at startup.
+type GatewayConfig struct {
+	Outlier        outlier.Config
+	CircuitBreaker circuitbreaker.Config
+
+	RetryBudgetRatio  float64
+	RetryBaseBackoff  time.Duration
+	RetryMaxBackoff   time.Duration
+	RetryMaxBodyBytes int64
+
+	// Transport holds the connection pool settings of services without a
+	// row in upstream_transports
+	Transport             upstream.Settings
+	DefaultRequestTimeout time.Duration
+
+	ErrorFormat gatewayerr.Format
+
+	// Upgraded connections are closed after this long without traffic
+	TunnelIdleTimeout time.Duration
+	// SSE responses and streaming routes are exempt from the total request
+	// timeout once headers arrived, and are cut after this long without data instead
+	StreamIdleTimeout time.Duration
+
+	// AccessLog receives one entry per request; nil disables access logging
+	AccessLog *accesslog.Logger
+
+	// Readiness checks; RedisAddress is optional and probed when set
+	ReadinessTimeout time.Duration
+	RedisAddress     string
+
+	TLS TLSSettings
+}
+
+// TLSSettings configure the HTTPS listener, disabled when Port is empty.
+// Certificates come from the file pairs and the tls_certificates table.
+type TLSSettings struct {
+	Port           string
+	CertFiles      []string
+	KeyFiles       []string
+	MinVersion     uint16
+	CipherSuites   []uint16 // TLS 1.2 only, nil = Go defaults
+	ReloadInterval time.Duration
+	// RedirectHTTP makes the plain HTTP listener redirect to HTTPS instead
+	// of serving requests
+	RedirectHTTP bool
+	// ACME obtains certificates for route hosts the files and the database
+	// have none for; disabled without a directory URL
+	ACME certs.ACMEConfig
+}
+
+// gatewayMetrics are the Prometheus metrics served on /metrics. Requests are
+// labelled by route ID, service and status class (2xx, 4xx, ...).
+type gatewayMetrics struct {
+	registry           *metrics.Registry
+	requests           *metrics.Vec
+	requestDuration    *metrics.HistogramVec
+	inFlight           *metrics.Vec
+	consulLookup       *metrics.HistogramVec
+	circuitTransitions *metrics.Vec
+	tunnelsActive      *metrics.Vec
+	tunnels            *metrics.Vec
+}
+
+func newGatewayMetrics() *gatewayMetrics {
+	r := metrics.NewRegistry()
+	return &gatewayMetrics{
+		registry: r,
+		requests: r.NewCounterVec("gateway_requests_total",
+			"Requests handled by the gateway.", "route", "service", "status_class"),
+		requestDuration: r.NewHistogramVec("gateway_request_duration_seconds",
+			"Time from receiving a request to finishing the response.", nil, "route", "service", "status_class"),
+		inFlight: r.NewGaugeVec("gateway_requests_in_flight",
+			"Requests currently being handled.", "route", "service"),
+		consulLookup: r.NewHistogramVec("gateway_consul_lookup_duration_seconds",
+			"Latency of Consul healthy instance lookups.", nil, "service", "result"),
+		circuitTransitions: r.NewCounterVec("gateway_circuit_transitions_total",
+			"Circuit breaker state changes.", "service", "from", "to"),
+		tunnelsActive: r.NewGaugeVec("gateway_tunnels_active",
+			"Upgraded connections (e.g. WebSocket) currently relayed.", "route", "service", "protocol"),
+		tunnels: r.NewCounterVec("gateway_tunnels_total",
+			"Upgraded connections relayed, by how they ended (closed, idle_timeout, error).", "route", "service", "protocol", "result"),
+	}
+}
+
+// registerUpstreamGauges adds gauges read from the gateway's health checker,
+// outlier detector and circuit breakers at scrape time.
+func (m *gatewayMetrics) registerUpstreamGauges(g *Gateway) {
+	m.registry.NewGaugeFunc("gateway_upstream_healthy",
+		"Active health check result per static target (1 healthy, 0 unhealthy).", []string{"target"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.healthChecker.Status() {
+				set(boolFloat(s.Healthy), s.Target)
+			}
+		})
+	m.registry.NewGaugeFunc("gateway_upstream_ejected",
+		"Whether outlier detection currently ejects an instance (1 ejected).", []string{"service", "instance"},
+		func(set func(float64, ...string)) {
+			for _, service := range g.upstreamServices() {
+				for _, s := range g.outliers.Status(service) {
+					set(boolFloat(s.Ejected), service, s.Instance)
+				}
+			}
+		})
+	m.registry.NewGaugeFunc("gateway_upstream_connections_open",
+		"Open connections in the upstream pool of a service.", []string{"service"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.pools.Stats() {
+				set(float64(s.OpenConns), s.Service)
+			}
+		})
+	m.registry.NewGaugeFunc("gateway_upstream_connections_idle",
+		"Open connections not serving a request (approximate).", []string{"service"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.pools.Stats() {
+				set(float64(max(s.OpenConns-s.ActiveRequests, 0)), s.Service)
+			}
+		})
+	m.registry.NewGaugeFunc("gateway_upstream_requests_active",
+		"Upstream requests waiting for or reading a response.", []string{"service"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.pools.Stats() {
+				set(float64(s.ActiveRequests), s.Service)
+			}
+		})
+	m.registry.NewCounterFunc("gateway_upstream_connections_total",
+		"Connections handed to upstream requests, by whether they were reused from the pool.", []string{"service", "reused"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.pools.Stats() {
+				set(float64(s.NewConns), s.Service, "false")
+				set(float64(s.ReusedConns), s.Service, "true")
+			}
+		})
+	m.registry.NewCounterFunc("gateway_upstream_dial_errors_total",
+		"Failed connection attempts to upstreams.", []string{"service"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.pools.Stats() {
+				set(float64(s.DialErrors), s.Service)
+			}
+		})
+	m.registry.NewGaugeFunc("gateway_circuit_state",
+		"Current circuit breaker state per service (1 for the active state).", []string{"service", "state"},
+		func(set func(float64, ...string)) {
+			for _, s := range g.breakers.Status() {
+				set(1, s.Name, s.State)
+			}
+		})
+}
+
+func (m *gatewayMetrics) circuitChanged(name string, from, to circuitbreaker.State) {
+	m.circuitTransitions.Inc(name, from.String(), to.String())
+}
+
+// observeRequest records a finished request; routeID 0 means no route matched.
+func (m *gatewayMetrics) observeRequest(routeID int, service string, status int, elapsed time.Duration) {
+	route := ""
+	if routeID != 0 {
+		route = strconv.Itoa(routeID)
+	}
+	class := strconv.Itoa(status/100) + "xx"
+	m.requests.Inc(route, service, class)
+	m.requestDuration.Observe(elapsed.Seconds(), route, service, class)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 type Gateway struct {
+	config           GatewayConfig
 	db               *sql.DB
 	routes           []Route
-	httpClient       *http.Client
+	pools            *upstream.Pools
 	serviceDiscovery *discovery.ServiceDiscovery
+	outliers         *outlier.Detector
+	healthChecker    *healthcheck.Checker
+	breakers         *circuitbreaker.Set
+	retryBudget      *retry.Budget
+	errorResponder   *gatewayerr.Responder
+	accessLog        *accesslog.Logger
+	metrics          *gatewayMetrics
+	probes           *probe.Checker
+	tunnels          *upstream.Tunnels
+	certs            *certs.Store // nil without TLS
+	acme             *certs.ACME  // nil without ACME
+
+	// round-robin position per service
+	balancerMu sync.Mutex
+	balancer   map[string]int
 }
 
-func NewGateway(dbURL string, consulAddress string) (*Gateway, error) {
+func NewGateway(dbURL string, consulAddress string, config GatewayConfig) (*Gateway, error) {
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
@@ -47,49 +338,317 @@ func NewGateway(dbURL string, consulAddress string) (*Gateway, error) {
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	// Create HTTP client for proxying requests
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	sd, err := discovery.NewServiceDiscovery(consulAddress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create service discovery client: %v", err)
 	}
 
-	gateway := &Gateway{db: db, httpClient: httpClient, serviceDiscovery: sd}
+	gatewayMetrics := newGatewayMetrics()
+	// One connection pool per service. Timeouts are applied per route
+	// through the request context rather than on the clients.
+	gateway := &Gateway{
+		config:           config,
+		db:               db,
+		pools:            upstream.NewPools(config.Transport),
+		serviceDiscovery: sd,
+		outliers:         outlier.NewDetector(config.Outlier),
+		healthChecker:    healthcheck.NewChecker(),
+		breakers:         circuitbreaker.NewSet(config.CircuitBreaker, gatewayMetrics.circuitChanged),
+		retryBudget:      retry.NewBudget(config.RetryBudgetRatio, 100),
+		errorResponder:   gatewayerr.NewResponder(config.ErrorFormat),
+		accessLog:        config.AccessLog,
+		metrics:          gatewayMetrics,
+		probes:           probe.NewChecker(config.ReadinessTimeout),
+		tunnels:          upstream.NewTunnels(),
+		balancer:         make(map[string]int),
+	}
 
 	if err := gateway.loadRoutes(); err != nil {
 		return nil, fmt.Errorf("failed to load routes: %v", err)
 	}
+	if err := gateway.loadTransports(); err != nil {
+		return nil, fmt.Errorf("failed to load upstream transports: %v", err)
+	}
+	if config.TLS.Port != "" {
+		if err := gateway.loadCertificates(); err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificates: %v", err)
+		}
+	}
+	gatewayMetrics.registerUpstreamGauges(gateway)
+	gateway.registerProbes()
+	gateway.startHealthChecks()
 
 	return gateway, nil
 }
 
-func (g *Gateway) ResolveTarget(route *Route) (string, error) {
-	logger.Info("Resolving target for route", route.PathPattern)
+// loadCertificates loads the certificates served over HTTPS and keeps
+// reloading them, so renewed files or rows apply without a restart.
+func (g *Gateway) loadCertificates() error {
+	g.certs = certs.NewStore(certs.Files(g.config.TLS.CertFiles, g.config.TLS.KeyFiles), g.certificatesFromDB)
+	if g.config.TLS.ACME.DirectoryURL != "" {
+		var err error
+		if g.acme, err = certs.NewACME(g.config.TLS.ACME, certs.NewDBCache(g.db), g.acmeHostAllowed); err != nil {
+			return fmt.Errorf("invalid ACME configuration: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := g.certs.Reload(ctx); err != nil {
+		if len(g.certs.Certificates()) == 0 {
+			return err
+		}
+		logger.Warn("Some TLS certificates could not be loaded", err)
+	}
+	if len(g.certs.Certificates()) == 0 && g.acme == nil {
+		return fmt.Errorf("no certificate configured: set TLS_CERT_FILE, add rows to tls_certificates or enable ACME")
+	}
+	for _, info := range g.certs.Certificates() {
+		logger.Info("Loaded TLS certificate", "source", info.Source, "names", info.Names, "not_after", info.NotAfter)
+	}
+	g.certs.Watch(g.config.TLS.ReloadInterval)
+	g.metrics.registry.NewGaugeFunc("gateway_tls_certificate_expiry_timestamp_seconds",
+		"Expiry of each served TLS certificate as a Unix timestamp.", []string{"source", "name"},
+		func(set func(float64, ...string)) {
+			for _, info := range g.certs.Certificates() {
+				name := ""
+				if len(info.Names) > 0 {
+					name = info.Names[0]
+				}
+				set(float64(info.NotAfter.Unix()), info.Source, name)
+			}
+		})
+	return nil
+}
+
+// certificatesFromDB returns the enabled rows of tls_certificates.
+func (g *Gateway) certificatesFromDB(ctx context.Context) ([]certs.KeyPair, error) {
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT name, cert_pem, key_pem
+		FROM tls_certificates
+		WHERE enabled = true
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query TLS certificates: %v", err)
+	}
+	defer rows.Close()
+
+	var pairs []certs.KeyPair
+	for rows.Next() {
+		var name, certPEM, keyPEM string
+		if err := rows.Scan(&name, &certPEM, &keyPEM); err != nil {
+			return nil, fmt.Errorf("failed to scan TLS certificate: %v", err)
+		}
+		pairs = append(pairs, certs.KeyPair{Source: "db:" + name, CertPEM: []byte(certPEM), KeyPEM: []byte(keyPEM)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over TLS certificates: %v", err)
+	}
+	return pairs, nil
+}
+
+// tlsConfig is the server configuration of the HTTPS listener.
+func (g *Gateway) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     g.config.TLS.MinVersion,
+		CipherSuites:   g.config.TLS.CipherSuites,
+		GetCertificate: g.certs.GetCertificate,
+	}
+	for _, route := range g.routes {
+		if route.ClientCAs != nil {
+			// Verified per route in handleRequest, as the CA depends on it
+			config.ClientAuth = tls.RequestClientCert
+			break
+		}
+	}
+	if g.acme != nil {
+		config.GetCertificate = g.getCertificate
+		config.NextProtos = []string{"h2", "http/1.1", certs.NextProto}
+	}
+	return config
+}
+
+// getCertificate prefers certificates from files and the database, then
+// obtains one through ACME for route hosts, and otherwise serves the
+// default certificate.
+func (g *Gateway) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certs.IsChallenge(hello) {
+		return g.acme.GetCertificate(hello)
+	}
+	if cert, ok := g.certs.Lookup(hello); ok {
+		return cert, nil
+	}
+	if g.acme.Allowed(strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")) {
+		return g.acme.GetCertificate(hello)
+	}
+	return g.certs.GetCertificate(hello)
+}
+
+// acmeHosts returns the exact hosts of all routes; wildcard patterns need
+// DNS-01 validation and are left to certificates from files or the database.
+func (g *Gateway) acmeHosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, route := range g.routes {
+		host := strings.ToLower(route.HostPattern)
+		if host == "" || strings.Contains(host, "*") || net.ParseIP(host) != nil || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func (g *Gateway) acmeHostAllowed(host string) bool {
+	return slices.Contains(g.acmeHosts(), host)
+}
+
+// obtainCertificates gets ACME certificates for route hosts without one from
+// files or the database. Listeners must be up to answer the challenges.
+func (g *Gateway) obtainCertificates() {
+	var hosts []string
+	for _, host := range g.acmeHosts() {
+		if _, ok := g.certs.Lookup(&tls.ClientHelloInfo{ServerName: host}); !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	g.acme.Obtain(hosts)
+}
+
+// ResolveTarget picks the upstream base URL for a request. Instances in
+// exclude (already tried by an earlier attempt) are avoided when possible.
+func (g *Gateway) ResolveTarget(ctx context.Context, route *Route, exclude map[string]bool) (string, error) {
+	log := logger.FromContext(ctx)
+	log.Info("Resolving target for route", "route", route.PathPattern)
 	if route.UseConsul && route.ServiceName != "" {
-		serviceURL, err := g.serviceDiscovery.GetHealthyService(route.ServiceName)
+		lookupStart := time.Now()
+		instances, err := g.serviceDiscovery.GetHealthyServices(ctx, route.ServiceName)
+		result := "ok"
 		if err != nil {
-			logger.Error("Failed to resolve service via Consul", err)
+			result = "error"
+		}
+		g.metrics.consulLookup.Observe(time.Since(lookupStart).Seconds(), route.ServiceName, result)
+		if err != nil {
+			log.Error("Failed to resolve service via Consul", err)
 			if route.TargetURL != "" {
-				logger.Warn("Using static target URL as fallback", route.TargetURL)
-				return route.TargetURL, nil
+				log.Warn("Using static target URL as fallback", "target", route.TargetURL)
+				return g.pickStaticTarget(ctx, route, exclude)
 			}
 			return "", err
 		}
-		return serviceURL, nil
+		return g.pickInstance(ctx, route.ServiceName, instances, exclude), nil
+	}
+	return g.pickStaticTarget(ctx, route, exclude)
+}
+
+// pickStaticTarget balances over the route's static targets, skipping the
+// ones that failed active health checks.
+func (g *Gateway) pickStaticTarget(ctx context.Context, route *Route, exclude map[string]bool) (string, error) {
+	var healthy []string
+	for _, target := range route.Targets() {
+		if g.healthChecker.Healthy(target) {
+			healthy = append(healthy, target)
+		}
+	}
+	if len(healthy) == 0 {
+		return "", fmt.Errorf("%w for route %s", discovery.ErrNoHealthyInstances, route.PathPattern)
+	}
+	return g.pickInstance(ctx, route.ServiceName, healthy, exclude), nil
+}
+
+// registerProbes sets up the readiness checks served on /readyz. Redis is not
+// used by the proxy path yet, so its failure only degrades readiness.
+func (g *Gateway) registerProbes() {
+	g.probes.Add("database", probe.DB(g.db))
+	g.probes.Add("consul", g.serviceDiscovery.Ping)
+	g.probes.Add("routes", probe.Func(func() error {
+		if len(g.routes) == 0 {
+			return errors.New("route table is empty")
+		}
+		return nil
+	}))
+	if g.config.RedisAddress != "" {
+		g.probes.AddOptional("redis", probe.Redis(g.config.RedisAddress))
 	}
-	return route.TargetURL, nil
+}
+
+// startHealthChecks begins active probing of the static targets of every
+// route that configures a health check path.
+func (g *Gateway) startHealthChecks() {
+	for _, route := range g.routes {
+		if route.HealthCheckPath == "" {
+			continue
+		}
+		cfg := healthcheck.Config{
+			Path:               route.HealthCheckPath,
+			Interval:           time.Duration(route.HealthCheckInterval) * time.Second,
+			Timeout:            time.Duration(route.HealthCheckTimeout) * time.Second,
+			HealthyThreshold:   route.HealthyThreshold,
+			UnhealthyThreshold: route.UnhealthyThreshold,
+		}
+		client, err := g.pools.Client(route.ServiceName)
+		if err != nil {
+			logger.Error("Falling back to a plain client for health checks", err, "service", route.ServiceName)
+		}
+		cfg.Client = client
+		for _, target := range route.Targets() {
+			logger.Debug("Starting active health checks", "target", target, "path", route.HealthCheckPath)
+			g.healthChecker.Add(target, cfg)
+		}
+	}
+}
+
+// pickInstance round-robins over the instances that are not currently
+// ejected by outlier detection. If every instance is ejected the full set is
+// used, since sending traffic somewhere beats failing every request. The same
+// fallback applies when every instance is excluded.
+func (g *Gateway) pickInstance(ctx context.Context, serviceName string, instances []string, exclude map[string]bool) string {
+	available := g.outliers.Filter(serviceName, instances)
+	if len(available) == 0 {
+		logger.FromContext(ctx).Warn("All instances ejected, ignoring outlier detection", "service", serviceName)
+		available = instances
+	}
+	if len(exclude) > 0 {
+		var fresh []string
+		for _, instance := range available {
+			if !exclude[instance] {
+				fresh = append(fresh, instance)
+			}
+		}
+		if len(fresh) > 0 {
+			available = fresh
+		}
+	}
+
+	g.balancerMu.Lock()
+	defer g.balancerMu.Unlock()
+	next := g.balancer[serviceName] % len(available)
+	g.balancer[serviceName] = next + 1
+	return available[next]
 }
 
 func (g *Gateway) loadRoutes() error {
 	query := `
 		SELECT id, path_pattern, service_name, method, auth_required, 
-		       rate_limit, cache_ttl, target_url, enabled, use_consul
+		       rate_limit, cache_ttl, target_url, enabled, use_consul,
+		       health_check_path, health_check_interval, health_check_timeout,
+		       healthy_threshold, unhealthy_threshold,
+		       retry_attempts, retry_on, retry_non_idempotent,
+		       connect_timeout_ms, response_header_timeout_ms, request_timeout_ms,
+		       error_page_template, streaming, flush_interval_ms, allow_upgrade, grpc,
+		       grpc_protoset, host_pattern, client_ca_file
 		FROM routes 
 		WHERE enabled = true
-		ORDER BY path_pattern DESC`
+		ORDER BY host_pattern = '', path_pattern DESC`
+
+	transcodeRules, err := g.loadTranscodeRules()
+	if err != nil {
+		return err
+	}
+	clientCertSubjects, err := g.loadClientCertSubjects()
+	if err != nil {
+		return err
+	}
 
 	stmt, err := g.db.Prepare(query)
 	if err != nil {
@@ -109,10 +668,45 @@ func (g *Gateway) loadRoutes() error {
 	for rows.Next() {
 		var r Route
 		if err := rows.Scan(&r.ID, &r.PathPattern, &r.ServiceName, &r.Method, &r.AuthRequired,
-			&r.RateLimit, &r.CacheTTL, &r.TargetURL, &r.Enabled, &r.UseConsul); err != nil {
+			&r.RateLimit, &r.CacheTTL, &r.TargetURL, &r.Enabled, &r.UseConsul,
+			&r.HealthCheckPath, &r.HealthCheckInterval, &r.HealthCheckTimeout,
+			&r.HealthyThreshold, &r.UnhealthyThreshold,
+			&r.RetryAttempts, &r.RetryOn, &r.RetryNonIdempotent,
+			&r.ConnectTimeoutMs, &r.ResponseHeaderTimeoutMs, &r.RequestTimeoutMs,
+			&r.ErrorPageTemplate, &r.Streaming, &r.FlushIntervalMs, &r.AllowUpgrade, &r.GRPC,
+			&r.GRPCProtoset, &r.HostPattern, &r.ClientCAFile); err != nil {
 			logger.Error("Failed to scan row", err)
 			return fmt.Errorf("failed to scan row: %v", err)
 		}
+		retryOn, err := retry.ParseStatusCodes(r.RetryOn)
+		if err != nil {
+			return fmt.Errorf("invalid retry_on for route %s: %v", r.PathPattern, err)
+		}
+		r.RetryPolicy = retry.Policy{Attempts: r.RetryAttempts, RetryOn: retryOn, NonIdempotent: r.RetryNonIdempotent}
+		if r.ErrorPageTemplate != "" {
+			if r.ErrorPage, err = gatewayerr.LoadPage(r.ErrorPageTemplate); err != nil {
+				return fmt.Errorf("invalid error page for route %s: %v", r.PathPattern, err)
+			}
+		}
+		if r.GRPCProtoset != "" {
+			// Transcoded calls need the service's HTTP/2 pool, which only
+			// gRPC routes get
+			if !r.GRPC {
+				return fmt.Errorf("route %s sets grpc_protoset but not grpc", r.PathPattern)
+			}
+			if r.Transcoder, err = transcode.Load(r.GRPCProtoset, transcodeRules[r.ID]); err != nil {
+				return fmt.Errorf("invalid gRPC transcoding for route %s: %v", r.PathPattern, err)
+			}
+			for _, b := range r.Transcoder.Bindings() {
+				logger.Debug("gRPC transcoding", "route", r.PathPattern, "http_method", b.HTTPMethod, "path", b.Path, "grpc_method", b.Method)
+			}
+		}
+		if r.ClientCAFile != "" {
+			if r.ClientCAs, err = certs.LoadCAs(r.ClientCAFile); err != nil {
+				return fmt.Errorf("invalid client CA bundle for route %s: %v", r.PathPattern, err)
+			}
+			r.ClientCertSubjects = clientCertSubjects[r.ID]
+		}
 		routes = append(routes, r)
 	}
 
@@ -121,43 +715,212 @@ func (g *Gateway) loadRoutes() error {
 		return fmt.Errorf("error iterating over rows: %v", err)
 	}
 
+	// Targets are probed once, on one path
+	probePaths := make(map[string]string)
+	for _, r := range routes {
+		if r.HealthCheckPath == "" {
+			continue
+		}
+		for _, target := range r.Targets() {
+			if path, ok := probePaths[target]; ok && path != r.HealthCheckPath {
+				return fmt.Errorf("route %s health checks %s at %s, but another route uses %s", r.PathPattern, target, r.HealthCheckPath, path)
+			}
+			probePaths[target] = r.HealthCheckPath
+		}
+	}
+
 	g.routes = routes
 
-	logger.Info("Loaded routes from database", len(routes))
+	logger.Info("Loaded routes from database", "count", len(routes))
 
 	// Print routes for debugging
 	for _, route := range routes {
-		logger.Debug("Route details", route)
+		logger.Debug("Route details", "route", route)
+	}
+
+	return nil
+}
+
+// loadTranscodeRules reads the explicit HTTP to gRPC mappings of each route,
+// for services whose protos carry no google.api.http options.
+func (g *Gateway) loadTranscodeRules() (map[int][]transcode.Rule, error) {
+	rows, err := g.db.Query(`
+		SELECT route_id, grpc_method, http_method, path_template, body, response_body
+		FROM grpc_http_rules
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gRPC HTTP rules: %v", err)
+	}
+	defer rows.Close()
+
+	rules := make(map[int][]transcode.Rule)
+	for rows.Next() {
+		var routeID int
+		var rule transcode.Rule
+		if err := rows.Scan(&routeID, &rule.Method, &rule.HTTPMethod, &rule.Path, &rule.Body, &rule.ResponseBody); err != nil {
+			return nil, fmt.Errorf("failed to scan gRPC HTTP rule: %v", err)
+		}
+		rules[routeID] = append(rules[routeID], rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over gRPC HTTP rules: %v", err)
+	}
+	return rules, nil
+}
+
+// loadClientCertSubjects reads the client certificate identities each route
+// accepts from its auth rules.
+func (g *Gateway) loadClientCertSubjects() (map[int][]string, error) {
+	rows, err := g.db.Query(`
+		SELECT route_id, client_cert_subjects
+		FROM auth_rules
+		WHERE client_cert_subjects IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auth rules: %v", err)
+	}
+	defer rows.Close()
+
+	subjects := make(map[int][]string)
+	for rows.Next() {
+		var routeID int
+		var patterns []string
+		if err := rows.Scan(&routeID, pq.Array(&patterns)); err != nil {
+			return nil, fmt.Errorf("failed to scan auth rule: %v", err)
+		}
+		subjects[routeID] = append(subjects[routeID], patterns...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over auth rules: %v", err)
+	}
+	return subjects, nil
+}
+
+// loadTransports reads per-service connection pool settings. Zero or NULL
+// columns fall back to the gateway defaults. Services behind gRPC routes
+// always use HTTP/2, so routes must be loaded first.
+func (g *Gateway) loadTransports() error {
+	rows, err := g.db.Query(`
+		SELECT service_name, max_idle_conns_per_host, max_conns_per_host,
+		       idle_conn_timeout_ms, keep_alive_ms, dial_timeout_ms, http2,
+		       tls_ca_file, tls_cert_file, tls_key_file, tls_server_name
+		FROM upstream_transports`)
+	if err != nil {
+		return fmt.Errorf("failed to query upstream transports: %v", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]upstream.Settings)
+	for rows.Next() {
+		var service string
+		var maxIdle, maxConns, idleMs, keepAliveMs, dialMs sql.NullInt64
+		var http2 sql.NullBool
+		var caFile, certFile, keyFile, serverName sql.NullString
+		if err := rows.Scan(&service, &maxIdle, &maxConns, &idleMs, &keepAliveMs, &dialMs, &http2,
+			&caFile, &certFile, &keyFile, &serverName); err != nil {
+			return fmt.Errorf("failed to scan upstream transport: %v", err)
+		}
+		s := g.config.Transport
+		if maxIdle.Int64 > 0 {
+			s.MaxIdleConnsPerHost = int(maxIdle.Int64)
+		}
+		if maxConns.Int64 > 0 {
+			s.MaxConnsPerHost = int(maxConns.Int64)
+		}
+		if idleMs.Int64 > 0 {
+			s.IdleConnTimeout = time.Duration(idleMs.Int64) * time.Millisecond
+		}
+		if keepAliveMs.Int64 > 0 {
+			s.KeepAlive = time.Duration(keepAliveMs.Int64) * time.Millisecond
+		}
+		if dialMs.Int64 > 0 {
+			s.DialTimeout = time.Duration(dialMs.Int64) * time.Millisecond
+		}
+		if http2.Valid {
+			s.HTTP2 = http2.Bool
+		}
+		if caFile.String != "" {
+			s.TLS.CAFile = caFile.String
+		}
+		if certFile.String != "" {
+			s.TLS.CertFile, s.TLS.KeyFile = certFile.String, keyFile.String
+		}
+		if serverName.String != "" {
+			s.TLS.ServerName = serverName.String
+		}
+		if _, err := upstream.ClientTLS(s.TLS); err != nil {
+			return fmt.Errorf("invalid TLS settings for service %s: %v", service, err)
+		}
+		settings[service] = s
+		logger.Debug("Upstream transport", "service", service, "settings", s)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over upstream transports: %v", err)
+	}
+	for _, route := range g.routes {
+		if !route.GRPC {
+			continue
+		}
+		s, ok := settings[route.ServiceName]
+		if !ok {
+			s = g.config.Transport
+		}
+		s.HTTP2 = true
+		settings[route.ServiceName] = s
 	}
 
+	g.pools.Configure(settings)
+	logger.Info("Loaded upstream transports", "count", len(settings))
 	return nil
 }
 
-func (g *Gateway) findRoute(path, method string) (*Route, error) {
-	logger.Debug("Finding route", "path", path, "method", method)
+func (g *Gateway) findRoute(ctx context.Context, host, path, method string) (*Route, error) {
+	log := logger.FromContext(ctx)
+	log.Debug("Finding route", "host", host, "path", path, "method", method)
 
+	// Routes for a specific host come first (see loadRoutes)
 	for _, route := range g.routes {
-		logger.Debug("Checking route", "pattern", route.PathPattern, "routeMethod", route.Method, "enabled", route.Enabled)
+		log.Debug("Checking route", "pattern", route.PathPattern, "routeMethod", route.Method, "enabled", route.Enabled)
+
+		if !matchHost(route.HostPattern, host) {
+			continue
+		}
 
 		// Check if method matches (or route accepts ANY method)
 		if route.Method != "ANY" && route.Method != method {
-			logger.Debug("Method mismatch: ", route.Method, "requestMethod", method)
+			log.Debug("Method mismatch", "routeMethod", route.Method, "requestMethod", method)
 			continue
 		}
 
 		// Check if path pattern matches
 		if g.matchPattern(route.PathPattern, path) {
-			logger.Debug("Route matched: ", route.PathPattern, "path", path)
+			log.Debug("Route matched", "pattern", route.PathPattern, "path", path)
 			return &route, nil
 		} else {
-			logger.Debug("Pattern mismatch: ", route.PathPattern, "path", path)
+			log.Debug("Pattern mismatch", "pattern", route.PathPattern, "path", path)
 		}
 	}
 
-	logger.Error("No route found", "path", path, "method", method)
+	log.Error("No route found", "path", path, "method", method)
 	return nil, fmt.Errorf("route not found for path: %s, method: %s", path, method)
 }
 
+// matchHost reports whether a request's Host header matches a route's host
+// pattern; "*.example.com" matches any subdomain but not example.com itself.
+func matchHost(pattern, host string) bool {
+	if pattern == "" {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
 func (g *Gateway) matchPattern(pattern, path string) bool {
 	if pattern == path {
 		return true
@@ -174,8 +937,7 @@ func (g *Gateway) matchPattern(pattern, path string) bool {
 func (g *Gateway) buildTargetURL(targetBaseURL, requestPath, routePattern string) (string, error) {
 	baseUrl, err := url.Parse(targetBaseURL)
 	if err != nil {
-		logger.Error("Failed to parse target URL", err)
-		return "", err
+		return "", fmt.Errorf("failed to parse target URL: %v", err)
 	}
 
 	var targetPath string
@@ -226,7 +988,7 @@ func (g *Gateway) shouldSkipHeader(header string) bool {
 		"Proxy-Authenticate",
 		"Proxy-Authorization",
 		"Te",
-		"Trailers",
+		"Trailer",
 		"Transfer-Encoding",
 		"Upgrade",
 	}
@@ -241,80 +1003,690 @@ func (g *Gateway) shouldSkipHeader(header string) bool {
 }
 
 func (g *Gateway) proxyRequest(w http.ResponseWriter, r *http.Request, route *Route) {
+	log := logger.FromContext(r.Context())
+	breaker := g.breakers.Get(route.ServiceName)
+	done, err := breaker.Allow()
+	if err != nil {
+		retryAfter := int(breaker.RetryAfter().Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		g.writeError(w, r, route, gatewayerr.New(http.StatusServiceUnavailable, gatewayerr.CodeCircuitOpen,
+			fmt.Sprintf("Service %s is temporarily unavailable, retry in %ds", route.ServiceName, retryAfter)))
+		log.Warn("Circuit open, rejecting request", "service", route.ServiceName)
+		return
+	}
+	// Only transport errors and 5xx responses count against the breaker;
+	// failures before any upstream attempt and client disconnects do not
+	outcome := circuitbreaker.Ignored
+	defer func() {
+		if r.Context().Err() != nil {
+			outcome = circuitbreaker.Ignored
+		}
+		done(outcome)
+	}()
 
-	//TODO: Resolve target URL from Consul if needed
-	//do this and resolve from consul
-	// for now localhost will not work for consul so we have to register the service with host.docker.internal
-	//need to deploy the service to docker in same network as of consul to fix this in dev
-	targetUrlFromDiscovery, err := g.ResolveTarget(route)
+	ctx, cancel := g.requestContext(r, route)
+	defer cancel()
+
+	retriesEnabled := route.RetryPolicy.Enabled(r.Method)
+	newBody, replayable, err := g.bufferRequestBody(r, retriesEnabled)
 	if err != nil {
-		http.Error(w, "Failed to resolve target URL from consul", http.StatusInternalServerError)
-		logger.Error("Failed to resolve target URL consul", err)
+		g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusBadRequest, gatewayerr.CodeBadRequest, "Failed to read request body"))
+		log.Error("Failed to read request body", err)
 		return
 	}
-	targetUrl, err := g.buildTargetURL(targetUrlFromDiscovery, r.URL.Path, route.PathPattern)
+	g.retryBudget.OnRequest()
+
+	entry := accesslog.FromContext(r.Context())
+	grpc := upstream.IsGRPC(r)
+	// gRPC methods are addressed by their full path, so a wildcard route
+	// must not strip its prefix
+	routePattern := route.PathPattern
+	if route.GRPC {
+		routePattern = r.URL.Path
+	}
+
+	tried := make(map[string]bool)
+	var resp *http.Response
+	var upstreamSpan *tracing.Span
+	cancelAttempt := context.CancelFunc(func() {})
+	defer func() { cancelAttempt() }()
+	stopDeadline := func() bool { return false }
+	// The last attempt's span also covers streaming the response body
+	defer func() {
+		if upstreamSpan != nil {
+			upstreamSpan.End()
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		//TODO: Resolve target URL from Consul if needed
+		//do this and resolve from consul
+		// for now localhost will not work for consul so we have to register the service with host.docker.internal
+		//need to deploy the service to docker in same network as of consul to fix this in dev
+		var targetUrlFromDiscovery, targetUrl string
+		var proxyRequest *http.Request
+		resolveStart := time.Now()
+		_, resolveSpan := tracing.Start(ctx, "discovery.resolve", tracing.KindInternal)
+		targetUrlFromDiscovery, err = g.ResolveTarget(ctx, route, tried)
+		entry.ResolveDuration += time.Since(resolveStart)
+		resolveSpan.SetAttributes("service", route.ServiceName, "use_consul", route.UseConsul, "target", targetUrlFromDiscovery)
+		resolveSpan.SetError(err)
+		resolveSpan.End()
+		if err != nil {
+			g.writeError(w, r, route, resolveError(route, err))
+			log.Error("Failed to resolve target URL consul", err)
+			return
+		}
+		tried[targetUrlFromDiscovery] = true
+		entry.Upstream = targetUrlFromDiscovery
+		entry.Attempts = attempt
+
+		targetUrl, err = g.buildTargetURL(targetUrlFromDiscovery, r.URL.Path, routePattern)
+		if err != nil {
+			g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusInternalServerError, gatewayerr.CodeInternal, "Failed to build target URL"))
+			log.Error("Failed to build target URL", err)
+			return
+		}
+		log.Info("Proxying request", "method", r.Method, "path", r.URL.Path, "target", targetUrl, "attempt", attempt)
+
+		//create new request to backend service using the complete target URL
+		// Attempts keep ctx's values but not its deadline, which cancels
+		// them through stopDeadline so streams can be released from it
+		attemptCtx, attemptCancel := context.WithCancel(context.WithoutCancel(ctx))
+		cancelAttempt = attemptCancel
+		stopDeadline = context.AfterFunc(ctx, attemptCancel)
+		attemptCtx, upstreamSpan = tracing.Start(attemptCtx, "upstream "+r.Method, tracing.KindClient)
+		upstreamSpan.SetAttributes("service", route.ServiceName, "url.full", targetUrl, "attempt", attempt)
+		proxyRequest, err = http.NewRequestWithContext(attemptCtx, r.Method, targetUrl, newBody())
+		if err != nil {
+			g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusInternalServerError, gatewayerr.CodeInternal, "Failed to create proxy request"))
+			log.Error("Failed to create proxy request", err)
+			return
+		}
+		g.copyHeaders(r.Header, proxyRequest.Header)
+		if len(r.Trailer) > 0 {
+			proxyRequest.Trailer = r.Trailer
+		}
+
+		// Add some gateway headers
+		proxyRequest.Header.Set("X-Gateway", "api-gateway")
+		proxyRequest.Header.Set("X-Forwarded-For", r.RemoteAddr)
+		proxyRequest.Header.Set("X-Original-Host", r.Host)
+		proxyRequest.Header.Set("X-Forwarded-Proto", requestScheme(r))
+		tracing.Inject(attemptCtx, proxyRequest.Header)
+		// Streaming routes' responses outlive the deadline, see below
+		if deadline, ok := ctx.Deadline(); ok && (grpc || !route.Streaming) {
+			proxyRequest.Header.Set(deadlineHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+			if grpc {
+				proxyRequest.Header.Set("Grpc-Timeout", upstream.FormatGRPCTimeout(time.Until(deadline)))
+			}
+		}
+		if grpc {
+			// Te is hop-by-hop, but gRPC servers reject calls without it
+			proxyRequest.Header.Set("Te", "trailers")
+		}
+
+		start := time.Now()
+		resp, err = g.doUpstream(route.ServiceName, proxyRequest, time.Duration(route.ResponseHeaderTimeoutMs)*time.Millisecond, cancelAttempt)
+		if err != nil && ctx.Err() != nil {
+			// The attempt only saw itself cancelled; report why ctx ended
+			err = fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		elapsed := time.Since(start)
+		entry.UpstreamDuration += elapsed
+		upstreamSpan.SetAttributes("http.response.status_code", status)
+		upstreamSpan.SetError(err)
+		if status >= 500 {
+			upstreamSpan.SetStatus(tracing.StatusError, "HTTP "+strconv.Itoa(status))
+		}
+		g.outliers.Record(route.ServiceName, targetUrlFromDiscovery, status, err, elapsed)
+		outcome = circuitbreaker.Success
+		if err != nil || status >= 500 {
+			outcome = circuitbreaker.Failure
+		}
+
+		delay := retry.Backoff(attempt, g.config.RetryBaseBackoff, g.config.RetryMaxBackoff)
+		if !g.shouldRetry(ctx, route, attempt, retriesEnabled && replayable, resp, err, delay) {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancelAttempt()
+		upstreamSpan.End()
+
+		log.Warn("Retrying upstream request", "service", route.ServiceName, "status", status, "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			g.writeError(w, r, route, gatewayerr.Upstream(ctx.Err()))
+			log.Warn("Request cancelled or timed out before retry", "path", r.URL.Path, "error", ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+	}
 	if err != nil {
-		http.Error(w, "Failed to build target URL", http.StatusInternalServerError)
-		logger.Error("Failed to build target URL", err)
+		g.writeError(w, r, route, gatewayerr.Upstream(err))
+		log.Error("Failed to proxy request", err)
 		return
 	}
-	logger.Info("Proxying request", "Method", r.Method, "Path", r.URL.Path, "Target URL", targetUrl)
+	defer resp.Body.Close()
+
+	g.copyHeaders(resp.Header, w.Header())
+	// Upstreams commonly echo the request ID; keep a single value
+	w.Header().Set(requestIDHeader, r.Header.Get(requestIDHeader))
+	// Announce trailers known up front so they can follow the body
+	announced := len(resp.Trailer)
+	for key := range resp.Trailer {
+		w.Header().Add("Trailer", key)
+	}
+	w.WriteHeader(resp.StatusCode)
 
-	//create new request to backend service using the complete target URL
-	proxyRequest, err := http.NewRequest(r.Method, targetUrl, r.Body)
+	interval := flushInterval(route, resp)
+	var body io.Reader = resp.Body
+	if !grpc && (route.Streaming || upstream.IsEventStream(resp)) {
+		// SSE and streaming routes may run past the total timeout as long
+		// as data keeps arriving. Other chunked bodies are still flushed as
+		// they arrive but keep the deadline, and so do gRPC calls.
+		stopDeadline()
+		stopClientCancel := context.AfterFunc(r.Context(), cancelAttempt)
+		defer stopClientCancel()
+		idle := upstream.NewIdleReader(resp.Body, g.config.StreamIdleTimeout, cancelAttempt)
+		defer idle.Stop()
+		body = idle
+	}
+
+	// Copy response body back to client
+	// Headers are already sent, so a failure here can only be logged
+	_, err = upstream.CopyBody(w, body, interval)
 	if err != nil {
-		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
-		logger.Error("Failed to create proxy request", err)
+		log.Error("Failed to copy response body", err)
+		return
+	}
+
+	// Trailer values are only known after the body was read. Ones that were
+	// not announced are sent with the http.TrailerPrefix convention.
+	for key, values := range resp.Trailer {
+		if len(resp.Trailer) != announced {
+			key = http.TrailerPrefix + key
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
+// proxyTranscoded serves a JSON/HTTP request from a gRPC method: the request
+// is converted to a gRPC call and sent through proxyRequest, so retries,
+// breakers and tracing apply as usual, and the gRPC response or status is
+// converted back to JSON. Responses are buffered, server streams are
+// returned as one JSON array.
+func (g *Gateway) proxyTranscoded(w http.ResponseWriter, r *http.Request, route *Route) {
+	log := logger.FromContext(r.Context())
+	binding, vars, ok := route.Transcoder.Match(r.Method, r.URL.EscapedPath())
+	if !ok {
+		g.writeError(w, r, route, gatewayerr.New(http.StatusNotFound, gatewayerr.CodeRouteNotFound,
+			fmt.Sprintf("No gRPC method is mapped to %s %s", r.Method, r.URL.Path)))
+		return
+	}
+	message, err := binding.EncodeRequest(r, vars)
+	if err != nil {
+		if errors.Is(err, transcode.ErrBadRequest) {
+			g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusBadRequest, gatewayerr.CodeBadRequest, err.Error()))
+		} else {
+			g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusBadRequest, gatewayerr.CodeBadRequest, "Failed to read request body"))
+		}
+		log.Warn("Failed to transcode request", "grpc_method", binding.Method, "error", err)
+		return
+	}
+	log.Debug("Transcoding request", "grpc_method", binding.Method)
+
+	call := r.Clone(transcode.NewContext(r.Context(), r))
+	call.Method = http.MethodPost
+	call.URL.Path = binding.GRPCPath()
+	call.URL.RawPath = ""
+	call.URL.RawQuery = ""
+	call.Body = io.NopCloser(bytes.NewReader(message))
+	call.ContentLength = int64(len(message))
+	call.Header.Del("Content-Length")
+	call.Header.Del("Accept-Encoding")
+	call.Header.Set("Content-Type", "application/grpc+proto")
+
+	recorder := transcode.NewResponseWriter(w)
+	g.proxyRequest(recorder, call, route)
+	if !recorder.GRPC() {
+		// Nothing came back from gRPC, e.g. the gateway already answered
+		// with an error
+		return
+	}
+
+	if code, message := recorder.Status(); code != gatewayerr.GRPCOK {
+		g.writeError(w, r, route, gatewayerr.FromGRPC(code, message))
+		return
+	}
+	body, err := binding.DecodeResponse(recorder.Body())
+	if err != nil {
+		g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusBadGateway, gatewayerr.CodeBadGateway, "Invalid gRPC response from upstream service"))
+		log.Error("Failed to transcode response", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// proxyUpgrade tunnels an HTTP Upgrade request such as a WebSocket handshake:
+// the handshake is forwarded once (upgrades are never retried), and when the
+// upstream switches protocols the client connection is hijacked and bytes
+// are relayed both ways until either side closes or the tunnel idles out.
+func (g *Gateway) proxyUpgrade(w http.ResponseWriter, r *http.Request, route *Route, protocol string) {
+	log := logger.FromContext(r.Context()).With("protocol", protocol)
+	entry := accesslog.FromContext(r.Context())
+	breaker := g.breakers.Get(route.ServiceName)
+	done, err := breaker.Allow()
+	if err != nil {
+		retryAfter := int(breaker.RetryAfter().Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		g.writeError(w, r, route, gatewayerr.New(http.StatusServiceUnavailable, gatewayerr.CodeCircuitOpen,
+			fmt.Sprintf("Service %s is temporarily unavailable, retry in %ds", route.ServiceName, retryAfter)))
+		log.Warn("Circuit open, rejecting upgrade", "service", route.ServiceName)
+		return
+	}
+	outcome := circuitbreaker.Ignored
+	defer func() {
+		if r.Context().Err() != nil {
+			outcome = circuitbreaker.Ignored
+		}
+		done(outcome)
+	}()
+
+	resolveStart := time.Now()
+	target, err := g.ResolveTarget(r.Context(), route, nil)
+	entry.ResolveDuration = time.Since(resolveStart)
+	if err != nil {
+		g.writeError(w, r, route, resolveError(route, err))
+		log.Error("Failed to resolve upgrade target", err)
+		return
+	}
+	entry.Upstream = target
+	entry.Attempts = 1
+	targetUrl, err := g.buildTargetURL(target, r.URL.Path, route.PathPattern)
+	if err != nil {
+		g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusInternalServerError, gatewayerr.CodeInternal, "Failed to build target URL"))
+		log.Error("Failed to build target URL", err)
 		return
 	}
-	g.copyHeaders(r.Header, proxyRequest.Header)
 
-	// Add some gateway headers
+	// The tunnel outlives the request timeout, only connecting is bounded
+	ctx := r.Context()
+	if route.ConnectTimeoutMs > 0 {
+		ctx = upstream.WithConnectTimeout(ctx, time.Duration(route.ConnectTimeoutMs)*time.Millisecond)
+	}
+	ctx, span := tracing.Start(ctx, "upstream upgrade", tracing.KindClient)
+	defer span.End()
+	span.SetAttributes("service", route.ServiceName, "url.full", targetUrl, "protocol", protocol)
+
+	proxyRequest, err := http.NewRequestWithContext(ctx, r.Method, targetUrl, nil)
+	if err != nil {
+		g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusInternalServerError, gatewayerr.CodeInternal, "Failed to create proxy request"))
+		log.Error("Failed to create upgrade request", err)
+		return
+	}
+	g.copyHeaders(r.Header, proxyRequest.Header)
+	proxyRequest.Header.Set("Connection", "Upgrade")
+	proxyRequest.Header.Set("Upgrade", protocol)
 	proxyRequest.Header.Set("X-Gateway", "api-gateway")
 	proxyRequest.Header.Set("X-Forwarded-For", r.RemoteAddr)
 	proxyRequest.Header.Set("X-Original-Host", r.Host)
+	proxyRequest.Header.Set("X-Forwarded-Proto", requestScheme(r))
+	tracing.Inject(ctx, proxyRequest.Header)
+
+	start := time.Now()
+	resp, err := g.pools.Do(route.ServiceName, proxyRequest)
+	entry.UpstreamDuration = time.Since(start)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	g.outliers.Record(route.ServiceName, target, status, err, entry.UpstreamDuration)
+	outcome = circuitbreaker.Success
+	if err != nil || status >= 500 {
+		outcome = circuitbreaker.Failure
+	}
+	if err != nil {
+		span.SetError(err)
+		g.writeError(w, r, route, gatewayerr.Upstream(err))
+		log.Error("Upgrade handshake failed", err)
+		return
+	}
+	span.SetAttributes("http.response.status_code", resp.StatusCode)
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// The upstream declined; relay its answer like any other response
+		defer resp.Body.Close()
+		g.copyHeaders(resp.Header, w.Header())
+		w.Header().Set(requestIDHeader, r.Header.Get(requestIDHeader))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	backend, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok || !strings.EqualFold(resp.Header.Get("Upgrade"), protocol) {
+		resp.Body.Close()
+		g.writeError(w, r, route, gatewayerr.New(http.StatusBadGateway, gatewayerr.CodeBadGateway,
+			fmt.Sprintf("Upstream switched to unexpected protocol %q", resp.Header.Get("Upgrade"))))
+		log.Error("Upstream switched to unexpected protocol", fmt.Errorf("requested %q, got %q", protocol, resp.Header.Get("Upgrade")))
+		outcome = circuitbreaker.Failure
+		return
+	}
 
-	resp, err := g.httpClient.Do(proxyRequest)
+	conn, brw, err := http.NewResponseController(w).Hijack()
 	if err != nil {
-		http.Error(w, "Failed to proxy request", http.StatusInternalServerError)
-		logger.Error("Failed to proxy request", err)
+		backend.Close()
+		g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusInternalServerError, gatewayerr.CodeInternal, "Connection cannot be upgraded"))
+		log.Error("Failed to hijack client connection", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	g.copyHeaders(resp.Header, w.Header())
-	w.WriteHeader(resp.StatusCode)
+	// Hop-by-hop headers of the 101 response are exactly what the client
+	// needs, so they are written through unfiltered
+	resp.Header.Set(requestIDHeader, r.Header.Get(requestIDHeader))
+	resp.Body = nil
+	if err := resp.Write(brw); err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		backend.Close()
+		log.Error("Failed to write upgrade response", err)
+		return
+	}
 
-	// Copy response body back to client
-	_, err = io.Copy(w, resp.Body)
+	// Bytes the client sent right after its handshake are already buffered
+	client := io.ReadWriteCloser(conn)
+	if brw.Reader.Buffered() > 0 {
+		client = &bufferedConn{Reader: io.MultiReader(brw.Reader, conn), Conn: conn}
+	}
+
+	routeLabel := strconv.Itoa(route.ID)
+	g.metrics.tunnelsActive.Inc(routeLabel, route.ServiceName, protocol)
+	defer g.metrics.tunnelsActive.Dec(routeLabel, route.ServiceName, protocol)
+	log.Info("Tunnel opened", "service", route.ServiceName, "target", target)
+	tunnelDone := g.tunnels.Add(func() {
+		client.Close()
+		backend.Close()
+	})
+	defer tunnelDone()
+
+	toBackend, toClient, err := upstream.Relay(client, backend, g.config.TunnelIdleTimeout)
+	result := "closed"
+	switch {
+	case errors.Is(err, upstream.ErrIdleTimeout):
+		result = "idle_timeout"
+	case err != nil:
+		result = "error"
+		span.SetError(err)
+	}
+	g.metrics.tunnels.Inc(routeLabel, route.ServiceName, protocol, result)
+	log.Info("Tunnel closed", "service", route.ServiceName, "result", result,
+		"bytes_to_backend", toBackend, "bytes_to_client", toClient, "duration", time.Since(start), "error", err)
+}
+
+// bufferedConn reads through Reader first, for data buffered while the
+// connection was still handled as HTTP.
+type bufferedConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// flushInterval decides how the response body is flushed to the client, see
+// upstream.CopyBody: streams are flushed on every write unless the route sets
+// a periodic interval.
+func flushInterval(route *Route, resp *http.Response) time.Duration {
+	if route.FlushIntervalMs > 0 {
+		return time.Duration(route.FlushIntervalMs) * time.Millisecond
+	}
+	if route.Streaming || upstream.IsStreaming(resp) {
+		return -1
+	}
+	return 0
+}
+
+// shouldRetry decides whether another attempt is made after attempt number
+// attempt finished with resp/err, consuming retry budget when it is. A retry
+// whose backoff delay would outlast ctx's deadline is not made, so the last
+// upstream response or error is returned instead of a timeout.
+func (g *Gateway) shouldRetry(ctx context.Context, route *Route, attempt int, allowed bool, resp *http.Response, err error, delay time.Duration) bool {
+	if !allowed || attempt > route.RetryPolicy.Attempts || !route.RetryPolicy.ShouldRetry(resp, err) {
+		return false
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		logger.FromContext(ctx).Warn("Retry backoff exceeds the request deadline, not retrying", "service", route.ServiceName, "delay", delay)
+		return false
+	}
+	if !g.retryBudget.TryRetry() {
+		logger.FromContext(ctx).Warn("Retry budget exhausted, not retrying", "service", route.ServiceName)
+		return false
+	}
+	return true
+}
+
+// requestContext derives the upstream context from the client request so a
+// client disconnect cancels the upstream call. It applies the route's total
+// timeout, tightened by a deadline forwarded from a downstream proxy or a
+// gRPC client's grpc-timeout, and carries the route's connect timeout to the transport.
+// gRPC clients without grpc-timeout ask for no deadline, e.g. for long-lived
+// streaming RPCs, so the gateway default does not apply to them; a route's
+// request_timeout_ms still does.
+func (g *Gateway) requestContext(r *http.Request, route *Route) (context.Context, context.CancelFunc) {
+	grpc := upstream.IsGRPC(r) && transcode.Original(r) == nil
+	timeout := g.config.DefaultRequestTimeout
+	if route.RequestTimeoutMs > 0 {
+		timeout = time.Duration(route.RequestTimeoutMs) * time.Millisecond
+	} else if grpc {
+		timeout = 0
+	}
+	if ms, err := strconv.ParseInt(r.Header.Get(deadlineHeader), 10, 64); err == nil && ms > 0 {
+		if incoming := time.Duration(ms) * time.Millisecond; timeout == 0 || incoming < timeout {
+			timeout = incoming
+		}
+	}
+	if incoming, ok := upstream.GRPCTimeout(r.Header); ok && grpc && (timeout == 0 || incoming < timeout) {
+		timeout = incoming
+	}
+
+	ctx := r.Context()
+	if route.ConnectTimeoutMs > 0 {
+		ctx = upstream.WithConnectTimeout(ctx, time.Duration(route.ConnectTimeoutMs)*time.Millisecond)
+	}
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// doUpstream sends an upstream request, cancelling it if response headers do
+// not arrive within headerTimeout. cancel must cancel the request's context.
+func (g *Gateway) doUpstream(service string, req *http.Request, headerTimeout time.Duration, cancel context.CancelFunc) (*http.Response, error) {
+	if headerTimeout <= 0 {
+		return g.pools.Do(service, req)
+	}
+
+	timer := time.AfterFunc(headerTimeout, cancel)
+	resp, err := g.pools.Do(service, req)
+	if !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("timeout awaiting response headers after %s: %w", headerTimeout, context.DeadlineExceeded)
+	}
+	return resp, err
+}
+
+// bufferRequestBody returns a function producing the upstream request body.
+// When retries are enabled the body is read into memory so every attempt can
+// replay it; bodies over RetryMaxBodyBytes are streamed and reported as not
+// replayable.
+func (g *Gateway) bufferRequestBody(r *http.Request, retriesEnabled bool) (func() io.Reader, bool, error) {
+	if !retriesEnabled {
+		return func() io.Reader { return r.Body }, false, nil
+	}
+
+	buffered, err := io.ReadAll(io.LimitReader(r.Body, g.config.RetryMaxBodyBytes+1))
 	if err != nil {
-		http.Error(w, "Failed to copy response body", http.StatusInternalServerError)
-		logger.Error("Failed to copy response body", err)
+		return nil, false, err
+	}
+	if int64(len(buffered)) > g.config.RetryMaxBodyBytes {
+		logger.FromContext(r.Context()).Debug("Request body too large to replay, retries disabled", "path", r.URL.Path)
+		return func() io.Reader { return io.MultiReader(bytes.NewReader(buffered), r.Body) }, false, nil
+	}
+	return func() io.Reader { return bytes.NewReader(buffered) }, true, nil
+}
+
+// resolveError maps a target resolution failure: no healthy instance and an
+// unreachable Consul both leave the gateway unable to serve, hence 503.
+func resolveError(route *Route, err error) *gatewayerr.Error {
+	if errors.Is(err, discovery.ErrNoHealthyInstances) {
+		return gatewayerr.Wrap(err, http.StatusServiceUnavailable, gatewayerr.CodeNoHealthyUpstream,
+			fmt.Sprintf("No healthy instances available for %s", route.ServiceName))
+	}
+	return gatewayerr.Wrap(err, http.StatusServiceUnavailable, gatewayerr.CodeDiscoveryUnavailable,
+		fmt.Sprintf("Unable to resolve %s", route.ServiceName))
+}
+
+// writeError sends an error response carrying the request ID in the format
+// the client asked for, using the route's custom error page (route may be
+// nil) for HTML clients. gRPC clients get the matching grpc-status instead.
+// When the client is already gone only the status is recorded.
+func (g *Gateway) writeError(w http.ResponseWriter, r *http.Request, route *Route, e *gatewayerr.Error) {
+	// Answer a transcoded call in the format its JSON client expects
+	if original := transcode.Original(r); original != nil {
+		r = original
+	}
+	if e.Status == gatewayerr.StatusClientClosedRequest {
+		logger.FromContext(r.Context()).Warn("Client closed request", "path", r.URL.Path)
+		w.WriteHeader(e.Status)
+		return
+	}
+	if upstream.IsGRPC(r) {
+		gatewayerr.WriteGRPC(w, e)
 		return
 	}
 
+	var page *template.Template
+	if route != nil {
+		page = route.ErrorPage
+	}
+	g.errorResponder.Write(w, r, r.Header.Get(requestIDHeader), e, page)
 }
 
 func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Received request", r.Method, r.URL.Path)
-	route, err := g.findRoute(r.URL.Path, r.Method)
+	// Accept the caller's request ID or mint one, then make it visible to the
+	// upstream (via the forwarded headers), the client and every log line
+	requestID := r.Header.Get(requestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = newRequestID()
+		r.Header.Set(requestIDHeader, requestID)
+	}
+	w.Header().Set(requestIDHeader, requestID)
+	r.Header.Del(clientCertSubjectHeader)
+	r.Header.Del(clientCertSANHeader)
+
+	// Continue the caller's trace, if any, so gateway spans nest under it
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "HTTP "+r.Method, tracing.KindServer)
+	span.SetAttributes("http.request.method", r.Method, "url.path", r.URL.Path, "request_id", requestID)
+	log := logger.With("request_id", requestID, "trace_id", span.SpanContext().TraceID.String())
+
+	// Wrap the response and body so the access log sees what was exchanged
+	entry := &accesslog.Entry{
+		Time:      time.Now(),
+		RequestID: requestID,
+		ClientIP:  clientIP(r),
+		User:      clientUser(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		Proto:     r.Proto,
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+	body := &accesslog.CountingBody{ReadCloser: r.Body}
+	r.Body = body
+	recorder := accesslog.NewResponseWriter(w)
+	w = recorder
+	defer func() {
+		entry.Status = recorder.Status()
+		entry.BytesIn = body.N
+		entry.BytesOut = recorder.BytesWritten()
+		entry.TotalDuration = time.Since(entry.Time)
+		g.accessLog.Log(entry)
+		g.metrics.observeRequest(entry.RouteID, entry.Service, entry.Status, entry.TotalDuration)
+
+		span.SetAttributes("http.response.status_code", entry.Status)
+		if entry.Status >= 500 {
+			span.SetStatus(tracing.StatusError, "HTTP "+strconv.Itoa(entry.Status))
+		}
+		span.End()
+	}()
+
+	ctx = logger.NewContext(ctx, log)
+	r = r.WithContext(accesslog.NewContext(ctx, entry))
+
+	log.Debug("Received request", "method", r.Method, "path", r.URL.Path)
+	_, matchSpan := tracing.Start(r.Context(), "route.match", tracing.KindInternal)
+	route, err := g.findRoute(r.Context(), r.Host, r.URL.Path, r.Method)
+	matchSpan.SetError(err)
+	matchSpan.End()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		logger.Error("Route not found for handleRRequest", err)
+		g.writeError(w, r, nil, gatewayerr.New(http.StatusNotFound, gatewayerr.CodeRouteNotFound, err.Error()))
+		log.Error("Route not found for handleRRequest", err)
 		return
 	}
 
-	logger.Info("Matched route", route.PathPattern, "for method", r.Method)
+	log.Info("Matched route", "pattern", route.PathPattern, "method", r.Method)
+	entry.RouteID = route.ID
+	entry.Service = route.ServiceName
+	span.SetAttributes("route.id", route.ID, "route.pattern", route.PathPattern, "service", route.ServiceName)
+	routeLabel := strconv.Itoa(route.ID)
+	g.metrics.inFlight.Inc(routeLabel, route.ServiceName)
+	defer g.metrics.inFlight.Dec(routeLabel, route.ServiceName)
 
-	if route.ServiceName == "gateway" {
-		g.handleGatewayEndpoint(w, r)
-		return
+	if route.ClientCAs != nil {
+		cert, err := certs.VerifyClient(r.TLS, route.ClientCAs)
+		if err != nil {
+			g.writeError(w, r, route, gatewayerr.Wrap(err, http.StatusUnauthorized, gatewayerr.CodeClientCertificate, "A valid client certificate is required"))
+			log.Warn("Client certificate rejected", "route", route.PathPattern, "error", err)
+			return
+		}
+		if !certs.MatchIdentity(cert, route.ClientCertSubjects) {
+			g.writeError(w, r, route, gatewayerr.New(http.StatusForbidden, gatewayerr.CodeForbidden, "Client certificate is not allowed for this route"))
+			log.Warn("Client certificate not allowed", "route", route.PathPattern, "subject", cert.Subject.String())
+			return
+		}
+		r = r.WithContext(certs.WithVerifiedClient(r.Context(), cert))
+		r.Header.Set(clientCertSubjectHeader, cert.Subject.String())
+		r.Header.Set(clientCertSANHeader, strings.Join(certs.SANs(cert), ","))
+		span.SetAttributes("tls.client.subject", cert.Subject.String())
 	}
 
 	if route.AuthRequired {
-		if !g.checkAuth(r) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			logger.Error("Unauthorized access", fmt.Errorf("unauthorized access to route: %s", route.PathPattern))
+		_, authSpan := tracing.Start(r.Context(), "auth", tracing.KindInternal)
+		authorized := g.checkAuth(r)
+		authSpan.SetAttributes("auth.authorized", authorized)
+		authSpan.End()
+		if !authorized {
+			g.writeError(w, r, route, gatewayerr.New(http.StatusUnauthorized, gatewayerr.CodeUnauthorized, "Unauthorized"))
+			log.Error("Unauthorized access", fmt.Errorf("unauthorized access to route: %s", route.PathPattern))
 			return
 		}
 	}
@@ -322,29 +1694,129 @@ func (g *Gateway) handleRequest(w http.ResponseWriter, r *http.Request) {
 	// Check authentication if required
 	if route.AuthRequired {
 		if !g.checkAuth(r) {
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			g.writeError(w, r, route, gatewayerr.New(http.StatusUnauthorized, gatewayerr.CodeUnauthorized, "Authentication required"))
 			return
 		}
 	}
 
+	// Gateway endpoints pass the same certificate and auth checks as proxied routes
+	if route.ServiceName == "gateway" {
+		g.handleGatewayEndpoint(w, r, route)
+		return
+	}
+
 	// Proxy the request to the backend service
+	if protocol, ok := upstream.IsUpgrade(r); ok && route.AllowUpgrade {
+		g.proxyUpgrade(w, r, route, protocol)
+		return
+	}
+	if route.Transcoder != nil && !upstream.IsGRPC(r) {
+		g.proxyTranscoded(w, r, route)
+		return
+	}
 	g.proxyRequest(w, r, route)
 
 }
 
+// requestScheme is the scheme the client used to reach the gateway.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// clientIP returns the address of the directly connected client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientUser identifies the caller for the access log. Only basic auth
+// carries a user name today; bearer tokens are not decoded.
+func clientUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// newRequestID returns a random UUID (version 4).
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// validRequestID accepts client supplied IDs only when they are short and
+// made of safe characters, so they cannot forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // handleGatewayEndpoint handles requests for the gateway itself
-func (g *Gateway) handleGatewayEndpoint(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) handleGatewayEndpoint(w http.ResponseWriter, r *http.Request, route *Route) {
 	switch r.URL.Path {
-	case "/health":
-		fmt.Fprint(w, "Gateway is healthy!")
+	case "/livez":
+		g.probes.LiveHandler(w, r)
+	case "/health", "/readyz":
+		g.probes.ReadyHandler(w, r)
 	case "/routes":
 		g.listRoutes(w)
+	case "/status":
+		g.upstreamStatus(w, r)
+	case "/admin/loglevel":
+		g.handleLogLevel(w, r, route)
+	case "/metrics":
+		g.metrics.registry.ServeHTTP(w, r)
 	default:
-		http.Error(w, "Not found", http.StatusNotFound)
-		logger.Error("Unknown endpoint", fmt.Errorf("unknown endpoint: %s", r.URL.Path))
+		g.writeError(w, r, nil, gatewayerr.New(http.StatusNotFound, gatewayerr.CodeRouteNotFound, "Not found"))
+		logger.FromContext(r.Context()).Error("Unknown endpoint", fmt.Errorf("unknown endpoint: %s", r.URL.Path))
 	}
 }
 
+// handleLogLevel reports the current log level on GET and changes it at
+// runtime on PUT/POST with ?level=debug|info|warn|error. Debug logs carry
+// full routes and request details, so changes are refused unless the route
+// requires auth.
+func (g *Gateway) handleLogLevel(w http.ResponseWriter, r *http.Request, route *Route) {
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		if !route.AuthRequired {
+			g.writeError(w, r, route, gatewayerr.New(http.StatusForbidden, gatewayerr.CodeForbidden, "Changing the log level requires a route with auth_required"))
+			logger.FromContext(r.Context()).Warn("Refused log level change on unauthenticated route", "route", route.PathPattern)
+			return
+		}
+		level, err := logger.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			g.writeError(w, r, nil, gatewayerr.Wrap(err, http.StatusBadRequest, gatewayerr.CodeBadRequest, err.Error()))
+			return
+		}
+		logger.SetLevel(level)
+		logger.FromContext(r.Context()).Warn("Log level changed", "level", logger.LevelName(level))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"level": logger.LevelName(logger.GetLevel())})
+}
+
 func (g *Gateway) listRoutes(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintf(w, "Configured Routes (%d):\n\n", len(g.routes))
@@ -358,11 +1830,61 @@ func (g *Gateway) listRoutes(w http.ResponseWriter) {
 		fmt.Fprintf(w, "Rate Limit: %d\n", route.RateLimit)
 		fmt.Fprintf(w, "Cache TTL: %d\n", route.CacheTTL)
 		fmt.Fprintf(w, "Enabled: %v\n", route.Enabled)
+		if route.HealthCheckPath != "" {
+			for _, target := range route.Targets() {
+				fmt.Fprintf(w, "Target health: %s (healthy: %v)\n", target, g.healthChecker.Healthy(target))
+			}
+		}
+		for _, instance := range g.outliers.Status(route.ServiceName) {
+			state := "active"
+			if instance.Ejected {
+				state = "ejected until " + instance.EjectedUntil.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "Instance: %s (%s, error rate %.2f, avg latency %.1fms)\n",
+				instance.Instance, state, instance.ErrorRate, instance.AvgLatencyMs)
+		}
 		fmt.Fprintf(w, "---\n")
 	}
 }
 
+// upstreamStatus reports the outlier detection state of every upstream
+// service referenced by a route, along with active health check results,
+// circuit breaker states and readiness checks including their errors.
+func (g *Gateway) upstreamStatus(w http.ResponseWriter, r *http.Request) {
+	status := make(map[string][]outlier.InstanceStatus)
+	for _, service := range g.upstreamServices() {
+		status[service] = g.outliers.Status(service)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"services":      status,
+		"health_checks": g.healthChecker.Status(),
+		"circuits":      g.breakers.Status(),
+		"readiness":     g.probes.Ready(r.Context()),
+	})
+}
+
+// upstreamServices returns the distinct backend service names of all routes.
+func (g *Gateway) upstreamServices() []string {
+	seen := make(map[string]bool)
+	var services []string
+	for _, route := range g.routes {
+		if route.ServiceName == "gateway" || seen[route.ServiceName] {
+			continue
+		}
+		seen[route.ServiceName] = true
+		services = append(services, route.ServiceName)
+	}
+	return services
+}
+
 func (g *Gateway) checkAuth(r *http.Request) bool {
+	// A certificate verified for this route authenticates the client, even
+	// one with an empty subject such as a SAN-only SPIFFE certificate
+	if certs.VerifiedClient(r.Context()) != nil {
+		return true
+	}
 	auth := r.Header.Get("Authorization")
 	return auth != "" // Very basic check for now
 }
@@ -382,6 +1904,11 @@ func main() {
 		logger.Error("Error loading .env file", err)
 	}
 
+	if err := logger.Configure(logger.ConfigFromEnv()); err != nil {
+		logger.Fatal("Invalid logging configuration", err)
+	}
+	tracing.Configure(tracing.ConfigFromEnv("psygateway"))
+
 	// Get database connection parameters from environment variables
 	user := os.Getenv("POSTGRES_USER")
 	password := os.Getenv("POSTGRES_PASSWORD")
@@ -397,20 +1924,345 @@ func main() {
 	// Construct database URL
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port, dbname)
 
+	config := GatewayConfig{
+		Outlier:           outlier.DefaultConfig(),
+		CircuitBreaker:    circuitbreaker.DefaultConfig(),
+		RetryBudgetRatio:  float64(envInt("RETRY_BUDGET_PERCENT", 20)) / 100,
+		RetryBaseBackoff:  envDuration("RETRY_BASE_BACKOFF", 50*time.Millisecond),
+		RetryMaxBackoff:   envDuration("RETRY_MAX_BACKOFF", time.Second),
+		RetryMaxBodyBytes: int64(envInt("RETRY_MAX_BODY_BYTES", 1<<20)),
+
+		DefaultRequestTimeout: envDuration("UPSTREAM_REQUEST_TIMEOUT", 30*time.Second),
+
+		ReadinessTimeout: envDuration("READINESS_CHECK_TIMEOUT", 2*time.Second),
+
+		TunnelIdleTimeout: envDuration("TUNNEL_IDLE_TIMEOUT", 5*time.Minute),
+		StreamIdleTimeout: envDuration("STREAM_IDLE_TIMEOUT", 5*time.Minute),
+	}
+	config.Transport = upstream.DefaultSettings()
+	config.Transport.DialTimeout = envDuration("UPSTREAM_CONNECT_TIMEOUT", config.Transport.DialTimeout)
+	config.Transport.MaxIdleConnsPerHost = envInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", config.Transport.MaxIdleConnsPerHost)
+	config.Transport.MaxConnsPerHost = envInt("UPSTREAM_MAX_CONNS_PER_HOST", config.Transport.MaxConnsPerHost)
+	config.Transport.IdleConnTimeout = envDuration("UPSTREAM_IDLE_CONN_TIMEOUT", config.Transport.IdleConnTimeout)
+	config.Transport.KeepAlive = envDuration("UPSTREAM_KEEP_ALIVE", config.Transport.KeepAlive)
+	config.Transport.HTTP2 = os.Getenv("UPSTREAM_HTTP2") == "true"
+	config.Transport.TLS = upstream.TLSFiles{
+		CAFile:   os.Getenv("UPSTREAM_TLS_CA_FILE"),
+		CertFile: os.Getenv("UPSTREAM_TLS_CERT_FILE"),
+		KeyFile:  os.Getenv("UPSTREAM_TLS_KEY_FILE"),
+	}
+	if _, err := upstream.ClientTLS(config.Transport.TLS); err != nil {
+		logger.Fatal("Invalid upstream TLS configuration", err)
+	}
+	if redisHost := os.Getenv("REDIS_HOST"); redisHost != "" {
+		redisPort := os.Getenv("REDIS_PORT")
+		if redisPort == "" {
+			redisPort = "6379"
+		}
+		config.RedisAddress = net.JoinHostPort(redisHost, redisPort)
+	}
+	config.ErrorFormat, err = gatewayerr.ParseFormat(os.Getenv("GATEWAY_ERROR_FORMAT"))
+	if err != nil {
+		logger.Warn("Invalid GATEWAY_ERROR_FORMAT, using json", err)
+	}
+	if config.AccessLog, err = openAccessLog(); err != nil {
+		logger.Fatal("Invalid access log configuration", err)
+	}
+	go reloadLoggingOnSIGHUP(config.AccessLog)
+	config.TLS = TLSSettings{
+		Port:           os.Getenv("TLS_PORT"),
+		CertFiles:      envList("TLS_CERT_FILE"),
+		KeyFiles:       envList("TLS_KEY_FILE"),
+		ReloadInterval: envDuration("TLS_RELOAD_INTERVAL", time.Minute),
+		RedirectHTTP:   os.Getenv("TLS_REDIRECT_HTTP") == "true",
+		ACME: certs.ACMEConfig{
+			DirectoryURL: os.Getenv("ACME_DIRECTORY_URL"),
+			Email:        os.Getenv("ACME_EMAIL"),
+			CAFile:       os.Getenv("ACME_CA_FILE"),
+			RenewBefore:  envDuration("ACME_RENEW_BEFORE", 0),
+		},
+	}
+	if config.TLS.ACME.DirectoryURL != "" && config.TLS.Port == "" {
+		logger.Fatal("ACME needs the HTTPS listener", errors.New("ACME_DIRECTORY_URL is set but TLS_PORT is not"))
+	}
+	if config.TLS.MinVersion, err = certs.ParseVersion(os.Getenv("TLS_MIN_VERSION")); err != nil {
+		logger.Fatal("Invalid TLS_MIN_VERSION", err)
+	}
+	if config.TLS.CipherSuites, err = certs.ParseCipherSuites(os.Getenv("TLS_CIPHER_SUITES")); err != nil {
+		logger.Fatal("Invalid TLS_CIPHER_SUITES", err)
+	}
+
+	config.Outlier.ConsecutiveFailures = envInt("OUTLIER_CONSECUTIVE_FAILURES", config.Outlier.ConsecutiveFailures)
+	config.Outlier.BaseEjectionTime = envDuration("OUTLIER_BASE_EJECTION_TIME", config.Outlier.BaseEjectionTime)
+	config.Outlier.MaxEjectionTime = envDuration("OUTLIER_MAX_EJECTION_TIME", config.Outlier.MaxEjectionTime)
+	config.Outlier.MaxEjectionPercent = envInt("OUTLIER_MAX_EJECTION_PERCENT", config.Outlier.MaxEjectionPercent)
+	config.Outlier.LatencyThreshold = envDuration("OUTLIER_LATENCY_THRESHOLD", config.Outlier.LatencyThreshold)
+	config.Outlier.ErrorRateThreshold = envFloat("OUTLIER_ERROR_RATE_THRESHOLD", config.Outlier.ErrorRateThreshold)
+	config.Outlier.MinRequests = envInt("OUTLIER_MIN_REQUESTS", config.Outlier.MinRequests)
+	config.Outlier.Window = envDuration("OUTLIER_WINDOW", config.Outlier.Window)
+
+	config.CircuitBreaker.FailureThreshold = envInt("CIRCUIT_FAILURE_THRESHOLD", config.CircuitBreaker.FailureThreshold)
+	config.CircuitBreaker.Cooldown = envDuration("CIRCUIT_COOLDOWN", config.CircuitBreaker.Cooldown)
+	config.CircuitBreaker.HalfOpenMaxRequests = envInt("CIRCUIT_HALF_OPEN_REQUESTS", config.CircuitBreaker.HalfOpenMaxRequests)
+	config.CircuitBreaker.SuccessThreshold = envInt("CIRCUIT_SUCCESS_THRESHOLD", config.CircuitBreaker.SuccessThreshold)
+
 	// Create gateway instance
-	gateway, err := NewGateway(dbURL, consulAddress)
+	gateway, err := NewGateway(dbURL, consulAddress, config)
 	if err != nil {
 		logger.Fatal("Failed to create gateway", err)
 	}
-	defer gateway.db.Close()
 
 	// Set up HTTP server
 	http.HandleFunc("/", gateway.handleRequest)
+	// HTTP/2 is negotiated over TLS and also accepted in cleartext with prior
+	// knowledge (h2c), which is how most gRPC clients call without TLS
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: ":" + gatewayPort, Protocols: &protocols}
+	servers := []*http.Server{server}
+
+	if config.TLS.Port != "" {
+		tlsServer := &http.Server{Addr: ":" + config.TLS.Port, Protocols: &protocols, TLSConfig: gateway.tlsConfig()}
+		servers = append(servers, tlsServer)
+		if config.TLS.RedirectHTTP {
+			server.Handler = redirectToHTTPS(config.TLS.Port)
+		}
+		if gateway.acme != nil {
+			// HTTP-01 challenges are answered before redirecting or routing
+			fallback := server.Handler
+			if fallback == nil {
+				fallback = http.DefaultServeMux
+			}
+			server.Handler = gateway.acme.HTTPHandler(fallback)
+		}
+		go reloadCertificatesOnSIGHUP(gateway.certs)
+
+		logger.Info("Starting gateway TLS server", "port", config.TLS.Port, "redirect_http", config.TLS.RedirectHTTP, "acme", gateway.acme != nil)
+		tlsListener, err := net.Listen("tcp", tlsServer.Addr)
+		if err != nil {
+			logger.Fatal("TLS server failed to start", err)
+		}
+		go func() {
+			// Certificates come from the store, not from files given here
+			if err := tlsServer.ServeTLS(tlsListener, "", ""); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("TLS server failed to start", err)
+			}
+		}()
+		if gateway.acme != nil {
+			// The listener is bound, so TLS-ALPN-01 challenges can be answered
+			go gateway.obtainCertificates()
+		}
+	}
 
-	logger.Info("Starting gateway server on :", gatewayPort)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		gateway.waitForShutdown(servers,
+			envDuration("SHUTDOWN_DELAY", 0),
+			envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	}()
 
-	if err := http.ListenAndServe(":"+gatewayPort, nil); err != nil {
+	logger.Info("Starting gateway server", "port", gatewayPort)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Fatal("Server failed to start", err)
 	}
+	<-stopped
+	logger.Info("Gateway stopped")
+}
+
+// redirectToHTTPS answers every plain HTTP request with a permanent redirect
+// to the same URL on the HTTPS listener.
+func redirectToHTTPS(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+// waitForShutdown blocks until SIGINT or SIGTERM, then shuts the gateway down:
+// readiness fails immediately, the listener stays open for delay so load
+// balancers notice, in-flight requests and open tunnels get up to timeout to
+// finish and finally the gateway's clients are closed.
+func (g *Gateway) waitForShutdown(servers []*http.Server, delay, timeout time.Duration) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	signal.Stop(sigChan)
+
+	logger.Info("Shutting down gateway", "signal", sig.String(), "delay", delay, "timeout", timeout)
+	g.probes.SetShuttingDown()
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				// Requests still running past the deadline are cut off
+				logger.Warn("Drain deadline exceeded, closing remaining connections", err, "addr", server.Addr)
+				server.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	// Upgraded connections are hijacked, so Shutdown did not wait for them
+	if closed := g.tunnels.Drain(ctx); closed > 0 {
+		logger.Warn("Drain deadline exceeded, closed open tunnels", "tunnels", closed)
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := tracing.Shutdown(flushCtx); err != nil {
+		logger.Warn("Failed to flush traces", err)
+	}
+	g.Close()
+}
+
+// Close stops background health checks, releases the gateway's upstream,
+// Consul and database connections and closes the access log.
+func (g *Gateway) Close() {
+	g.healthChecker.Stop()
+	if g.certs != nil {
+		g.certs.Stop()
+	}
+	g.pools.CloseIdleConnections()
+	g.serviceDiscovery.Close()
+	if err := g.db.Close(); err != nil {
+		logger.Error("Failed to close database", err)
+	}
+	if err := g.accessLog.Close(); err != nil {
+		logger.Error("Failed to close access log", err)
+	}
+}
+
+// openAccessLog builds the access logger from ACCESS_LOG_OUTPUT (a log output
+// spec such as stderr or file:/var/log/access.log, "off" to disable; default
+// file:logs/access.log) and ACCESS_LOG_FORMAT (json, common, combined or
+// template:...). Outputs shared with the application logs are refused.
+func openAccessLog() (*accesslog.Logger, error) {
+	spec := os.Getenv("ACCESS_LOG_OUTPUT")
+	if spec == "off" {
+		return nil, nil
+	}
+	if spec == "" {
+		spec = "file:logs/access.log"
+	}
+	appOutputs := logger.ConfigFromEnv().Outputs
+	if len(appOutputs) == 0 {
+		appOutputs = []string{"stdout"}
+	}
+	target, _, _ := strings.Cut(spec, "?")
+	for _, out := range appOutputs {
+		if appTarget, _, _ := strings.Cut(out, "?"); appTarget == target {
+			return nil, fmt.Errorf("ACCESS_LOG_OUTPUT %s is also an application log output (LOG_OUTPUTS)", target)
+		}
+	}
+	w, err := logger.OpenWriter(spec)
+	if err != nil {
+		return nil, err
+	}
+	return accesslog.New(w, os.Getenv("ACCESS_LOG_FORMAT"))
+}
+
+// reloadLoggingOnSIGHUP re-reads the .env file on SIGHUP and applies its
+// logging settings, which also reopens log files after external rotation.
+// The access log keeps its output but is reopened too.
+func reloadLoggingOnSIGHUP(accessLog *accesslog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := godotenv.Overload(); err != nil {
+			logger.Warn("Failed to reload .env file", err)
+		}
+		if err := accessLog.Reopen(); err != nil {
+			logger.Error("Failed to reopen access log", err)
+		}
+		if err := logger.Configure(logger.ConfigFromEnv()); err != nil {
+			logger.Error("Failed to reload logging configuration", err)
+			continue
+		}
+		logger.Info("Reloaded logging configuration", "level", logger.LevelName(logger.GetLevel()))
+	}
+}
+
+// envInt reads an integer environment variable, falling back to def when it
+// is unset or invalid.
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warn("Invalid integer in environment, using default", "name", name, "value", value)
+		return def
+	}
+	return n
+}
 
+// envDuration reads a duration environment variable such as "30s", falling
+// back to def when it is unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Warn("Invalid duration in environment, using default", "name", name, "value", value)
+		return def
+	}
+	return d
+}
+
+// envFloat reads a decimal environment variable such as "0.5", falling back
+// to def when it is unset or invalid.
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.Warn("Invalid number in environment, using default", "name", name, "value", value)
+		return def
+	}
+	return f
+}
+
+// envList splits a comma separated environment variable, skipping blanks.
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// reloadCertificatesOnSIGHUP reloads TLS certificates right away on SIGHUP
+// rather than at the next reload interval.
+func reloadCertificatesOnSIGHUP(store *certs.Store) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		store.ReloadNow()
+	}
 }
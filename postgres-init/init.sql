@@ -4,11 +4,33 @@ CREATE TABLE routes (
     path_pattern VARCHAR(255) NOT NULL,  -- "/api/users/*"
     service_name VARCHAR(100) NOT NULL,  -- "user-service" 
     method VARCHAR(10) DEFAULT 'ANY',    -- "GET", "POST", "ANY"
-    target_url VARCHAR(500) NOT NULL,    -- "http://user-service:3000"
+    target_url VARCHAR(500) NOT NULL,    -- "http://user-service:3000", comma separated for several targets
     auth_required BOOLEAN DEFAULT false,
     rate_limit INTEGER DEFAULT 100,
     cache_ttl INTEGER DEFAULT 0,         -- seconds, 0 = no cache
     enabled BOOLEAN DEFAULT true,
+    use_consul BOOLEAN NOT NULL DEFAULT false,    -- resolve service_name via Consul instead of target_url
+    health_check_path VARCHAR(255) NOT NULL DEFAULT '', -- active health check path, '' = disabled; routes sharing a target must agree
+    health_check_interval INTEGER NOT NULL DEFAULT 10,  -- seconds
+    health_check_timeout INTEGER NOT NULL DEFAULT 2,    -- seconds
+    healthy_threshold INTEGER NOT NULL DEFAULT 2,
+    unhealthy_threshold INTEGER NOT NULL DEFAULT 3,
+    retry_attempts INTEGER NOT NULL DEFAULT 0,    -- retries after the first attempt
+    retry_on VARCHAR(100) NOT NULL DEFAULT '502,503,504', -- status codes to retry, transport errors (incl. header timeouts) always retry
+    retry_non_idempotent BOOLEAN NOT NULL DEFAULT false,  -- also retry POST/PATCH
+    connect_timeout_ms INTEGER NOT NULL DEFAULT 0,         -- 0 = gateway default
+    response_header_timeout_ms INTEGER NOT NULL DEFAULT 0, -- 0 = no limit besides the total timeout
+    request_timeout_ms INTEGER NOT NULL DEFAULT 0,         -- total, including retries; 0 = gateway default (gRPC: the client's grpc-timeout or none)
+    error_page_template VARCHAR(500) NOT NULL DEFAULT '',  -- html/template file for HTML error pages, '' = built-in
+    streaming BOOLEAN NOT NULL DEFAULT false,    -- flush every write; SSE and chunked responses are detected anyway
+                                                 -- SSE responses and streaming routes are exempt from request_timeout_ms once headers arrived
+                                                 -- and end after STREAM_IDLE_TIMEOUT without data instead (gRPC keeps its deadline)
+    flush_interval_ms INTEGER NOT NULL DEFAULT 0, -- > 0 = flush periodically instead of on every write
+    allow_upgrade BOOLEAN NOT NULL DEFAULT false,  -- tunnel WebSocket / HTTP Upgrade requests
+    grpc BOOLEAN NOT NULL DEFAULT false,           -- gRPC upstream: forward /package.Service/Method paths as is over HTTP/2
+    grpc_protoset VARCHAR(500) NOT NULL DEFAULT '', -- descriptor set for JSON to gRPC transcoding, requires grpc; '' = none
+    host_pattern VARCHAR(255) NOT NULL DEFAULT '', -- "api.example.com" or "*.example.com", '' = any host
+    client_ca_file VARCHAR(500) NOT NULL DEFAULT '', -- PEM CA bundle; requests must present a client certificate it issued, '' = none
     created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -18,7 +40,8 @@ CREATE TABLE auth_rules (
     route_id INTEGER REFERENCES routes(id),
     required_roles TEXT[],               -- {"admin", "user"}
     api_key_required BOOLEAN DEFAULT false,
-    jwt_required BOOLEAN DEFAULT false
+    jwt_required BOOLEAN DEFAULT false,
+    client_cert_subjects TEXT[]          -- client certificate CNs or SANs accepted on mTLS routes, {"*.partner.com"}; NULL = any the CA issued
 );
 
 -- API Keys
@@ -32,3 +55,55 @@ CREATE TABLE api_keys (
     expires_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT NOW()
 );
+
+-- Upstream connection pools, one per service. Services without a row use the
+-- gateway defaults (UPSTREAM_* environment variables); 0 or NULL keeps the
+-- default for that setting.
+CREATE TABLE upstream_transports (
+    service_name VARCHAR(100) PRIMARY KEY,
+    max_idle_conns_per_host INTEGER DEFAULT 0,
+    max_conns_per_host INTEGER DEFAULT 0,     -- includes active connections
+    idle_conn_timeout_ms INTEGER DEFAULT 0,
+    keep_alive_ms INTEGER DEFAULT 0,          -- TCP keep-alive period
+    dial_timeout_ms INTEGER DEFAULT 0,        -- routes' connect_timeout_ms still take precedence
+    http2 BOOLEAN,                            -- HTTP/2 only (h2c for http:// targets), NULL = default
+    tls_ca_file VARCHAR(500),                 -- CA bundle for https targets' certificates, NULL = UPSTREAM_TLS_CA_FILE
+    tls_cert_file VARCHAR(500),               -- client certificate presented to the service, NULL = UPSTREAM_TLS_CERT_FILE
+    tls_key_file VARCHAR(500),
+    tls_server_name VARCHAR(255),             -- name expected in the service's certificate, e.g. for discovered IPs
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- HTTP to gRPC mappings of transcoding routes (routes.grpc_protoset), in
+-- addition to the google.api.http options in the protoset. A rule here wins
+-- over an option with the same HTTP method and path.
+CREATE TABLE grpc_http_rules (
+    id SERIAL PRIMARY KEY,
+    route_id INTEGER REFERENCES routes(id) ON DELETE CASCADE,
+    grpc_method VARCHAR(255) NOT NULL,        -- package.Service/Method
+    http_method VARCHAR(10) NOT NULL,
+    path_template VARCHAR(500) NOT NULL,      -- e.g. /v1/users/{id}
+    body VARCHAR(100) NOT NULL DEFAULT '',             -- request field read from the JSON body, '*' = whole message
+    response_body VARCHAR(100) NOT NULL DEFAULT '',    -- response field returned instead of the whole message
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- TLS certificates served next to TLS_CERT_FILE/TLS_KEY_FILE, picked by SNI
+-- and reloaded every TLS_RELOAD_INTERVAL.
+CREATE TABLE tls_certificates (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    cert_pem TEXT NOT NULL,                   -- leaf first, then intermediates
+    key_pem TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- ACME account, certificates and challenge tokens, shared by all gateway
+-- replicas (ACME_DIRECTORY_URL)
+CREATE TABLE acme_cache (
+    key VARCHAR(255) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,74 @@
+-- Brings a database created from an older init.sql up to date. Every
+-- statement is idempotent: docker runs this file right after init.sql on a
+-- fresh volume, and existing databases apply it with
+--   make migrate
+-- before starting a newer gateway.
+
+ALTER TABLE routes
+    ADD COLUMN IF NOT EXISTS use_consul BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS health_check_path VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS health_check_interval INTEGER NOT NULL DEFAULT 10,
+    ADD COLUMN IF NOT EXISTS health_check_timeout INTEGER NOT NULL DEFAULT 2,
+    ADD COLUMN IF NOT EXISTS healthy_threshold INTEGER NOT NULL DEFAULT 2,
+    ADD COLUMN IF NOT EXISTS unhealthy_threshold INTEGER NOT NULL DEFAULT 3,
+    ADD COLUMN IF NOT EXISTS retry_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS retry_on VARCHAR(100) NOT NULL DEFAULT '502,503,504',
+    ADD COLUMN IF NOT EXISTS retry_non_idempotent BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS connect_timeout_ms INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS response_header_timeout_ms INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS request_timeout_ms INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS error_page_template VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS streaming BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS flush_interval_ms INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS allow_upgrade BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS grpc BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS grpc_protoset VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS host_pattern VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS client_ca_file VARCHAR(500) NOT NULL DEFAULT '';
+
+ALTER TABLE auth_rules
+    ADD COLUMN IF NOT EXISTS client_cert_subjects TEXT[];
+
+CREATE TABLE IF NOT EXISTS upstream_transports (
+    service_name VARCHAR(100) PRIMARY KEY,
+    max_idle_conns_per_host INTEGER DEFAULT 0,
+    max_conns_per_host INTEGER DEFAULT 0,
+    idle_conn_timeout_ms INTEGER DEFAULT 0,
+    keep_alive_ms INTEGER DEFAULT 0,
+    dial_timeout_ms INTEGER DEFAULT 0,
+    http2 BOOLEAN,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE upstream_transports
+    ADD COLUMN IF NOT EXISTS tls_ca_file VARCHAR(500),
+    ADD COLUMN IF NOT EXISTS tls_cert_file VARCHAR(500),
+    ADD COLUMN IF NOT EXISTS tls_key_file VARCHAR(500),
+    ADD COLUMN IF NOT EXISTS tls_server_name VARCHAR(255);
+
+CREATE TABLE IF NOT EXISTS grpc_http_rules (
+    id SERIAL PRIMARY KEY,
+    route_id INTEGER REFERENCES routes(id) ON DELETE CASCADE,
+    grpc_method VARCHAR(255) NOT NULL,
+    http_method VARCHAR(10) NOT NULL,
+    path_template VARCHAR(500) NOT NULL,
+    body VARCHAR(100) NOT NULL DEFAULT '',
+    response_body VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS tls_certificates (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    cert_pem TEXT NOT NULL,
+    key_pem TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS acme_cache (
+    key VARCHAR(255) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
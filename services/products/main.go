@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/Antimatterr/psygateway/internal/discovery"
 	"github.com/Antimatterr/psygateway/internal/logger"
+	"github.com/Antimatterr/psygateway/internal/probe"
+	"github.com/Antimatterr/psygateway/internal/tracing"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -29,6 +34,10 @@ type Product struct {
 
 var db *sql.DB
 
+// probes backs the health endpoint Consul checks; it fails when the database
+// is unreachable or the service is shutting down.
+var probes = probe.NewChecker(2 * time.Second)
+
 func init() {
 	// Load environment variables
 	err := godotenv.Load(".env")
@@ -39,6 +48,10 @@ func init() {
 			logger.Warn("Could not load .env file, using system environment variables", err)
 		}
 	}
+	if err := logger.Configure(logger.ConfigFromEnv()); err != nil {
+		logger.Warn("Invalid logging configuration", err)
+	}
+	tracing.Configure(tracing.ConfigFromEnv("product-service"))
 
 	// Get database connection parameters from environment variables
 	user := os.Getenv("POSTGRES_USER")
@@ -59,6 +72,7 @@ func init() {
 	}
 
 	logger.Info("Connected to database", "host", host, "port", port, "dbname", dbname)
+	probes.Add("database", probe.DB(db))
 }
 
 func getProducts() ([]Product, error) {
@@ -105,7 +119,7 @@ func getProducts() ([]Product, error) {
 	}
 
 	for _, product := range products {
-		logger.Debug("Product details", "ID", product.ID, "Name", product.Name, "Price", product.Price, "Category", product.Category)
+		logger.Debug("Product details", "id", product.ID, "name", product.Name, "price", product.Price, "category", product.Category)
 	}
 
 	return products, nil
@@ -126,7 +140,7 @@ func handleGetProductById(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		http.Error(w, "Invalid product ID", http.StatusBadRequest)
-		logger.Error("Invalid product ID format", "ID", idStr, "Error", err)
+		logger.Error("Invalid product ID format", "id", idStr, "error", err)
 		return
 	}
 	var product Product
@@ -145,7 +159,7 @@ func handleGetProductById(w http.ResponseWriter, r *http.Request) {
 		&product.StockQuantity, &product.Category, &product.Status, &product.CreatedAt, &product.UpdatedAt)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Product not found", http.StatusNotFound)
-		logger.Warn("Product not found for: ", id)
+		logger.Warn("Product not found", "id", id)
 		return
 	}
 	if err != nil {
@@ -154,14 +168,16 @@ func handleGetProductById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	logger.Info("Fetched product by ID", product.ID, "Name", product.Name)
+	logger.Info("Fetched product by ID", "id", product.ID, "name", product.Name)
 	json.NewEncoder(w).Encode(product)
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	logger.Info("Health check", "Product service is running")
+	report := probes.Ready(r.Context())
+	if report.Status != probe.StatusOK {
+		logger.Warn("Health check failed", "service", "product-service", "status", report.Status, "checks", report.Checks)
+	}
+	probe.WriteReport(w, report)
 }
 
 func main() {
@@ -174,7 +190,7 @@ func main() {
 	sd, err := discovery.NewServiceDiscovery(consulAddress)
 
 	if err != nil {
-		logger.Error("Failed to create service discovery")
+		logger.Fatal("Failed to create service discovery client", err)
 	}
 
 	if productPort == "" {
@@ -188,17 +204,49 @@ func main() {
 	}
 
 	//Register the service with consul
-	sd.RegisterService("product-service", "product-service", port, "/api/product/health")
-
-	if err != nil {
+	registrar := sd.NewRegistrar(discovery.Registration{
+		ServiceName:     "product-service",
+		Address:         "product-service",
+		Port:            port,
+		HealthCheckPath: "/api/product/health",
+		Tags:            []string{"api", "products"},
+	})
+	if err := registrar.Start(); err != nil {
 		logger.Fatal("Failed to register product service with consul", err)
 	}
 
-	logger.Info("Product service registerd and started on port", port)
+	logger.Info("Product service registered", "port", port)
+
+	server := &http.Server{Addr: ":" + productPort, Handler: tracing.Middleware(http.DefaultServeMux)}
+
+	// Deregister from Consul on shutdown
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
 
-	if err := http.ListenAndServe(":"+productPort, nil); err != nil {
+		logger.Info("Shutting down product service...")
+
+		probes.SetShuttingDown()
+		if err := registrar.Stop(); err != nil {
+			logger.Error("Failed to deregister service", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Fatal("Server failed to start", err)
 	}
+
+	// Export spans still buffered before the process exits
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		logger.Warn("Failed to flush traces", err)
+	}
 	logger.Info("Products service started successfully")
-	logger.Info("Listening on port", productPort)
+	logger.Info("Listening on port", "port", productPort)
 }
@@ -15,6 +15,8 @@ import (
 
 	"github.com/Antimatterr/psygateway/internal/discovery"
 	"github.com/Antimatterr/psygateway/internal/logger"
+	"github.com/Antimatterr/psygateway/internal/probe"
+	"github.com/Antimatterr/psygateway/internal/tracing"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -29,12 +31,20 @@ type User struct {
 
 var db *sql.DB
 
+// probes backs the health endpoint Consul checks; it fails when the database
+// is unreachable or the service is shutting down.
+var probes = probe.NewChecker(2 * time.Second)
+
 func init() {
 	// Load environment variables
 	err := godotenv.Load(".env")
 	if err != nil {
 		log.Printf("Error loading .env file: %v", err)
 	}
+	if err := logger.Configure(logger.ConfigFromEnv()); err != nil {
+		log.Printf("Invalid logging configuration: %v", err)
+	}
+	tracing.Configure(tracing.ConfigFromEnv("user-service"))
 
 	// Get database connection parameters from environment variables
 	user := os.Getenv("POSTGRES_USER")
@@ -54,7 +64,8 @@ func init() {
 		logger.Fatal("Failed to ping DB", err)
 	}
 
-	logger.Info("Connected to database", fmt.Sprintf("%s:%s/%s", host, port, dbname))
+	logger.Info("Connected to database", "host", host, "port", port, "dbname", dbname)
+	probes.Add("database", probe.DB(db))
 }
 
 func getUsers(w http.ResponseWriter, r *http.Request) {
@@ -76,7 +87,7 @@ func getUsers(w http.ResponseWriter, r *http.Request) {
 		}
 		users = append(users, user)
 	}
-	logger.Info("Fetched users", fmt.Sprintf("Count: %d", len(users)))
+	logger.Info("Fetched users", "count", len(users))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(users)
 }
@@ -100,15 +111,17 @@ func getUserByID(w http.ResponseWriter, r *http.Request) {
 		logger.Error("Failed to fetch user", err)
 		return
 	}
-	logger.Info("Fetched user", fmt.Sprintf("ID: %d, Username: %s", user.ID, user.Username))
+	logger.Info("Fetched user", "id", user.ID, "username", user.Username)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	logger.Info("Health check", "User service is running")
+	report := probes.Ready(r.Context())
+	if report.Status != probe.StatusOK {
+		logger.Warn("Health check failed", "service", "user-service", "status", report.Status, "checks", report.Checks)
+	}
+	probe.WriteReport(w, report)
 }
 
 func main() {
@@ -137,19 +150,20 @@ func main() {
 	}
 
 	// Register this service with Consul
-	err = sd.RegisterService(
-		"user-service",
-		"user-service", // Use container name for Docker networking
-		port,           // Use the actual port from environment
-		"/api/user/health",
-	)
-	if err != nil {
+	registrar := sd.NewRegistrar(discovery.Registration{
+		ServiceName:     "user-service",
+		Address:         "user-service", // Use container name for Docker networking
+		Port:            port,           // Use the actual port from environment
+		HealthCheckPath: "/api/user/health",
+		Tags:            []string{"api", "users"},
+	})
+	if err := registrar.Start(); err != nil {
 		logger.Fatal("Failed to register user service with Consul", err)
 	}
-	logger.Info("User service registered with Consul", "port", port)
+	logger.Info("User service registered with Consul", "port", port, "id", registrar.ID())
 
 	// Create HTTP server
-	server := &http.Server{Addr: ":" + userPort}
+	server := &http.Server{Addr: ":" + userPort, Handler: tracing.Middleware(http.DefaultServeMux)}
 
 	// Handle graceful shutdown
 	go func() {
@@ -159,8 +173,9 @@ func main() {
 
 		logger.Info("Shutting down user service...")
 
-		// Deregister from Consul
-		if err := sd.DeregisterService("user-service"); err != nil {
+		// Fail health checks and deregister from Consul
+		probes.SetShuttingDown()
+		if err := registrar.Stop(); err != nil {
 			logger.Error("Failed to deregister service", err)
 		}
 
@@ -175,4 +190,11 @@ func main() {
 		logger.Fatal("Server failed to start", err)
 	}
 
+	// Export spans still buffered before the process exits
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		logger.Warn("Failed to flush traces", err)
+	}
+
 }